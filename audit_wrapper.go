@@ -0,0 +1,360 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"time"
+)
+
+// AuditResult is the result of an audited operation.
+type AuditResult string
+
+const (
+	AuditSuccess AuditResult = "success"
+	AuditFailure AuditResult = "failure"
+)
+
+// AuditRecord describes an operation audited by NewAuditWrapper.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Actor is the identity of the caller, set with WithIdentity.
+	Actor string `json:"actor,omitempty"`
+	Op    Op     `json:"op"`
+	Path  string `json:"path"`
+	// Method is the method of the signed URL, for OpURL.
+	Method string `json:"method,omitempty"`
+	// Size is the number of bytes written by Create, or read from a File returned by Open.
+	Size int64 `json:"size,omitempty"`
+	// SHA256 is the hex-encoded SHA-256 of the content written by Create, or of the content of a File
+	// returned by Open if it was read entirely.
+	SHA256 string      `json:"sha256,omitempty"`
+	Result AuditResult `json:"result"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// AuditSink receives the records of NewAuditWrapper.  It must be safe for concurrent use.
+type AuditSink interface {
+	WriteRecord(ctx context.Context, record *AuditRecord) error
+}
+
+// AuditSinkFunc is an AuditSink calling a func with each record.
+type AuditSinkFunc func(ctx context.Context, record *AuditRecord) error
+
+// WriteRecord implements AuditSink.
+func (f AuditSinkFunc) WriteRecord(ctx context.Context, record *AuditRecord) error {
+	return f(ctx, record)
+}
+
+// NewJSONLinesAuditSink creates an AuditSink writing each record to w as a line of JSON, e.g. to an *os.File
+// opened with os.O_APPEND.
+func NewJSONLinesAuditSink(w io.Writer) AuditSink {
+	return &jsonLinesAuditSink{
+		enc: json.NewEncoder(w),
+	}
+}
+
+type jsonLinesAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// WriteRecord implements AuditSink.
+func (s *jsonLinesAuditSink) WriteRecord(_ context.Context, record *AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enc.Encode(record)
+}
+
+// NewFSAuditSink creates an AuditSink writing the records to fs in batches of batchSize records, as new
+// JSON lines files under prefix.  Files are created with WriterOptions.IfNotExist, so existing records are
+// never overwritten.
+//
+// Callers must call Flush to write the last batch, e.g. before exiting.
+func NewFSAuditSink(fs FS, prefix string, batchSize int) *FSAuditSink {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	return &FSAuditSink{
+		fs:        fs,
+		prefix:    prefix,
+		batchSize: batchSize,
+	}
+}
+
+// FSAuditSink is an AuditSink writing batches of records to an FS.
+type FSAuditSink struct {
+	fs        FS
+	prefix    string
+	batchSize int
+
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	count int
+	seq   int
+}
+
+// WriteRecord implements AuditSink.  The batch is written to the FS once it is full.
+func (s *FSAuditSink) WriteRecord(ctx context.Context, record *AuditRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Write(b)
+	s.buf.WriteByte('\n')
+	s.count++
+	if s.count < s.batchSize {
+		return nil
+	}
+
+	return s.flush(ctx)
+}
+
+// Flush writes the pending records to the FS.
+func (s *FSAuditSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.flush(ctx)
+}
+
+// flush writes the batch, which is kept to be retried if the write fails.
+func (s *FSAuditSink) flush(ctx context.Context) error {
+	if s.count == 0 {
+		return nil
+	}
+
+	s.seq++
+	path := fmt.Sprintf("%s%s-%06d.jsonl", s.prefix, time.Now().UTC().Format(versionIDLayout), s.seq)
+	if err := Write(ctx, s.fs, path, s.buf.Bytes(), &WriterOptions{
+		Attributes: Attributes{ContentType: "application/x-ndjson"},
+		IfNotExist: true,
+	}); err != nil {
+		return err
+	}
+	s.buf.Reset()
+	s.count = 0
+
+	return nil
+}
+
+// AuditOptions are used to configure NewAuditWrapper.
+type AuditOptions struct {
+	// Reads enables the auditing of Open.
+	Reads bool
+}
+
+// NewAuditWrapper creates an FS which writes an AuditRecord to sink for each Create, Delete and URL call,
+// and for each Open call if enabled by options.  Records of Create and Open are written when the writer
+// or File is closed, with the size and hash of the content.
+//
+// Errors of the sink are returned by the audited operation, even though the operation was done.
+func NewAuditWrapper(fs FS, sink AuditSink, options *AuditOptions) FS {
+	if options == nil {
+		options = &AuditOptions{}
+	}
+
+	return &auditWrapper{
+		fs:      fs,
+		sink:    sink,
+		options: options,
+	}
+}
+
+type auditWrapper struct {
+	fs      FS
+	sink    AuditSink
+	options *AuditOptions
+}
+
+func (a *auditWrapper) newRecord(ctx context.Context, op Op, path string) *AuditRecord {
+	return &AuditRecord{
+		Time:  time.Now(),
+		Actor: IdentityFromContext(ctx),
+		Op:    op,
+		Path:  path,
+	}
+}
+
+// write writes record with the result of err, and returns err, or the error of the sink.
+func (a *auditWrapper) write(ctx context.Context, record *AuditRecord, err error) error {
+	record.Result = AuditSuccess
+	if err != nil {
+		record.Result = AuditFailure
+		record.Error = err.Error()
+	}
+
+	if sinkErr := a.sink.WriteRecord(ctx, record); sinkErr != nil && err == nil {
+		return fmt.Errorf("storage %s: audit: %w", record.Path, sinkErr)
+	}
+
+	return err
+}
+
+// auditHash counts and hashes the content of a read or write.
+type auditHash struct {
+	n int64
+	h hash.Hash
+}
+
+func newAuditHash() *auditHash {
+	return &auditHash{h: sha256.New()}
+}
+
+func (h *auditHash) Write(p []byte) (int, error) {
+	h.n += int64(len(p))
+
+	return h.h.Write(p)
+}
+
+func (h *auditHash) set(record *AuditRecord, complete bool) {
+	record.Size = h.n
+	if complete {
+		record.SHA256 = hex.EncodeToString(h.h.Sum(nil))
+	}
+}
+
+type auditReadCloser struct {
+	io.ReadCloser
+	h      *auditHash
+	eof    bool
+	closed bool
+
+	close func(h *auditHash, eof bool, err error) error
+}
+
+func (r *auditReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.h.Write(p[:n])
+	if err == io.EOF { //nolint:errorlint // io.EOF is never wrapped by Read.
+		r.eof = true
+	}
+
+	return n, err
+}
+
+// Close implements io.Closer.  The record is only written by the first call.
+func (r *auditReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	if r.closed {
+		return err
+	}
+	r.closed = true
+
+	return r.close(r.h, r.eof, err)
+}
+
+// Open implements FS.
+func (a *auditWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	if !a.options.Reads {
+		return a.fs.Open(ctx, path, options)
+	}
+
+	record := a.newRecord(ctx, OpOpen, path)
+	f, err := a.fs.Open(ctx, path, options)
+	if err != nil {
+		return nil, a.write(ctx, record, err)
+	}
+
+	f.ReadCloser = &auditReadCloser{
+		ReadCloser: f.ReadCloser,
+		h:          newAuditHash(),
+		close: func(h *auditHash, eof bool, err error) error {
+			h.set(record, eof)
+
+			return a.write(ctx, record, err)
+		},
+	}
+
+	return f, nil
+}
+
+// Attributes implements FS.
+func (a *auditWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	return a.fs.Attributes(ctx, path, options)
+}
+
+type auditWriteCloser struct {
+	io.WriteCloser
+	h      *auditHash
+	closed bool
+
+	close func(h *auditHash, err error) error
+}
+
+func (w *auditWriteCloser) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.h.Write(p[:n])
+
+	return n, err
+}
+
+// Close implements io.Closer.  The record is only written by the first call.
+func (w *auditWriteCloser) Close() error {
+	err := w.WriteCloser.Close()
+	if w.closed {
+		return err
+	}
+	w.closed = true
+
+	return w.close(w.h, err)
+}
+
+// Create implements FS.
+func (a *auditWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	record := a.newRecord(ctx, OpCreate, path)
+	wc, err := a.fs.Create(ctx, path, options)
+	if err != nil {
+		return nil, a.write(ctx, record, err)
+	}
+
+	return &auditWriteCloser{
+		WriteCloser: wc,
+		h:           newAuditHash(),
+		close: func(h *auditHash, err error) error {
+			h.set(record, true)
+
+			return a.write(ctx, record, err)
+		},
+	}, nil
+}
+
+// Delete implements FS.
+func (a *auditWrapper) Delete(ctx context.Context, path string) error {
+	record := a.newRecord(ctx, OpDelete, path)
+
+	return a.write(ctx, record, a.fs.Delete(ctx, path))
+}
+
+// Walk implements FS.
+func (a *auditWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	return a.fs.Walk(ctx, path, fn)
+}
+
+// URL implements FS.
+func (a *auditWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	record := a.newRecord(ctx, OpURL, path)
+	record.Method = DefaultSignedURLMethod
+	if options != nil && options.Method != "" {
+		record.Method = options.Method
+	}
+
+	url, err := a.fs.URL(ctx, path, options)
+	if err := a.write(ctx, record, err); err != nil {
+		return "", err
+	}
+
+	return url, nil
+}
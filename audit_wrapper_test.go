@@ -0,0 +1,174 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+type recordingSink struct {
+	mu      sync.Mutex
+	records []storage.AuditRecord
+}
+
+func (s *recordingSink) WriteRecord(_ context.Context, record *storage.AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, *record)
+
+	return nil
+}
+
+func TestAuditWrapper(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		fs := storage.NewAuditWrapper(mem, &recordingSink{}, &storage.AuditOptions{Reads: true})
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+	})
+}
+
+func TestAuditWrapper_records(t *testing.T) {
+	ctx := storage.WithIdentity(context.Background(), "alice")
+
+	withMem(func(mem storage.FS) {
+		sink := &recordingSink{}
+		fs := storage.NewAuditWrapper(mem, storage.AuditSinkFunc(sink.WriteRecord), nil)
+
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), nil))
+		_, err := storage.Read(ctx, fs, "foo", nil)
+		require.NoError(t, err)
+		_, err = fs.URL(ctx, "foo", &storage.SignedURLOptions{Method: "PUT"})
+		assert.ErrorIs(t, err, storage.ErrNotImplemented)
+		require.NoError(t, fs.Delete(ctx, "foo"))
+
+		// Reads are not audited by default
+		require.Len(t, sink.records, 3)
+
+		sum := sha256.Sum256([]byte("bar"))
+		create := sink.records[0]
+		assert.Equal(t, "alice", create.Actor)
+		assert.Equal(t, storage.OpCreate, create.Op)
+		assert.Equal(t, "foo", create.Path)
+		assert.Equal(t, int64(3), create.Size)
+		assert.Equal(t, hex.EncodeToString(sum[:]), create.SHA256)
+		assert.Equal(t, storage.AuditSuccess, create.Result)
+		assert.False(t, create.Time.IsZero())
+
+		url := sink.records[1]
+		assert.Equal(t, "PUT", url.Method)
+		assert.Equal(t, storage.AuditFailure, url.Result)
+		assert.Equal(t, storage.ErrNotImplemented.Error(), url.Error)
+
+		assert.Equal(t, storage.OpDelete, sink.records[2].Op)
+	})
+}
+
+func TestAuditWrapper_sinkError(t *testing.T) {
+	ctx := context.Background()
+	errSink := errors.New("sink is down")
+
+	withMem(func(mem storage.FS) {
+		fs := storage.NewAuditWrapper(mem, storage.AuditSinkFunc(func(context.Context, *storage.AuditRecord) error {
+			return errSink
+		}), nil)
+
+		assert.ErrorIs(t, storage.Write(ctx, fs, "foo", []byte("bar"), nil), errSink)
+	})
+
+	withLocal(func(local storage.FS) {
+		testutils.Create(t, local, "foo", "bar")
+		fs := storage.NewAuditWrapper(local, storage.AuditSinkFunc(func(context.Context, *storage.AuditRecord) error {
+			return errSink
+		}), nil)
+
+		url, err := fs.URL(ctx, "foo", nil)
+		assert.ErrorIs(t, err, errSink)
+		assert.Empty(t, url)
+	})
+}
+
+func TestAuditWrapper_closeTwice(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		sink := &recordingSink{}
+		fs := storage.NewAuditWrapper(mem, sink, &storage.AuditOptions{Reads: true})
+
+		w, err := fs.Create(ctx, "foo", nil)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		_ = w.Close()
+
+		f, err := fs.Open(ctx, "foo", nil)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		_ = f.Close()
+
+		assert.Len(t, sink.records, 2)
+	})
+}
+
+func TestJSONLinesAuditSink(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		var buf bytes.Buffer
+		fs := storage.NewAuditWrapper(mem, storage.NewJSONLinesAuditSink(&buf), &storage.AuditOptions{Reads: true})
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), nil))
+		_, err := storage.Read(ctx, fs, "foo", nil)
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+
+		var record storage.AuditRecord
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+		assert.Equal(t, storage.OpOpen, record.Op)
+		assert.Equal(t, int64(3), record.Size)
+		assert.NotEmpty(t, record.SHA256)
+	})
+}
+
+func TestFSAuditSink(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		withMem(func(auditFS storage.FS) {
+			sink := storage.NewFSAuditSink(auditFS, "audit/", 2)
+			fs := storage.NewAuditWrapper(mem, sink, nil)
+
+			for _, path := range []string{"a", "b", "c"} {
+				require.NoError(t, storage.Write(ctx, fs, path, []byte("bar"), nil))
+			}
+
+			paths, err := storage.List(ctx, auditFS, "audit/")
+			require.NoError(t, err)
+			require.Len(t, paths, 1, "the second batch isn't full")
+
+			require.NoError(t, sink.Flush(ctx))
+			paths, err = storage.List(ctx, auditFS, "audit/")
+			require.NoError(t, err)
+			require.Len(t, paths, 2)
+
+			var count int
+			for _, path := range paths {
+				data, err := storage.Read(ctx, auditFS, path, nil)
+				require.NoError(t, err)
+				count += strings.Count(string(data), "\n")
+			}
+			assert.Equal(t, 3, count)
+		})
+	})
+}
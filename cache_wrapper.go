@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
 	"time"
 )
@@ -19,6 +20,9 @@ type CacheOptions struct {
 
 	// NoData disables caching of the contents of the entries, it only stores the metadata.
 	NoData bool
+
+	// Clock is used to stamp and expire the entries.  Defaults to the system clock.
+	Clock Clock
 }
 
 // NewCacheWrapper creates an FS implementation which caches files opened from src into cache.
@@ -31,6 +35,7 @@ func NewCacheWrapper(src, cache FS, options *CacheOptions) FS {
 		src:     src,
 		cache:   cache,
 		options: options,
+		clock:   clockOrDefault(options.Clock),
 	}
 }
 
@@ -73,6 +78,7 @@ type cacheWrapper struct {
 	src     FS
 	cache   FS
 	options *CacheOptions
+	clock   Clock
 }
 
 func (c *cacheWrapper) isExpired(file *File) bool {
@@ -89,7 +95,7 @@ func (c *cacheWrapper) isExpired(file *File) bool {
 		return c.options.DefaultExpired
 	}
 
-	return time.Since(creationTime) > c.options.MaxAge
+	return c.clock.Now().Sub(creationTime) > c.options.MaxAge
 }
 
 func (c *cacheWrapper) openCache(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
@@ -98,6 +104,9 @@ func (c *cacheWrapper) openCache(ctx context.Context, path string, options *Read
 		return nil, err
 	}
 	if c.options.NoData {
+		// The cache doesn't know the checksums of the content
+		clearChecksums(&f.Attributes)
+
 		// Override the ReadCloser to actually fetch from the src
 		// If Read is not called, it still allows to read the attributes
 		f.ReadCloser = &openForwarder{
@@ -128,7 +137,10 @@ func (c *cacheWrapper) Open(ctx context.Context, path string, options *ReaderOpt
 	defer sf.Close()
 
 	cacheAttrs := sf.Attributes
-	cacheAttrs.CreationTime = time.Now() // The cache requires the CreationTime, so the original value is overwritten
+	cacheAttrs.CreationTime = c.clock.Now() // The cache requires the CreationTime, so the original value is overwritten
+	if c.options.NoData {
+		clearChecksums(&cacheAttrs)
+	}
 	wc, err := c.cache.Create(ctx, path, &WriterOptions{
 		Attributes: cacheAttrs,
 	})
@@ -136,8 +148,9 @@ func (c *cacheWrapper) Open(ctx context.Context, path string, options *ReaderOpt
 		return nil, err
 	}
 
+	checksums := newChecksummer()
 	if !c.options.NoData {
-		if _, err := io.Copy(wc, sf); err != nil {
+		if _, err := io.Copy(wc, io.TeeReader(sf, checksums)); err != nil {
 			wc.Close()
 
 			return nil, err
@@ -145,6 +158,10 @@ func (c *cacheWrapper) Open(ctx context.Context, path string, options *ReaderOpt
 	}
 
 	if err := wc.Close(); err != nil {
+		if errors.Is(err, ErrChecksumMismatch) {
+			_ = c.cache.Delete(ctx, path) // Don't leave a corrupted file in the cache
+		}
+
 		return nil, err
 	}
 
@@ -153,6 +170,16 @@ func (c *cacheWrapper) Open(ctx context.Context, path string, options *ReaderOpt
 		return nil, err
 	}
 
+	if !c.options.NoData {
+		// Check that the content was cached without being corrupted
+		if err := checksums.verify(path, &ff.Attributes); err != nil {
+			_ = ff.Close()
+			_ = c.cache.Delete(ctx, path)
+
+			return nil, err
+		}
+	}
+
 	return ff, nil
 }
 
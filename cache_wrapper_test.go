@@ -66,8 +66,10 @@ func TestCacheWrapper_Delete(t *testing.T) {
 }
 
 func TestCacheWrapper_CacheOptions_MaxAge(t *testing.T) {
+	clock := testutils.NewFakeClock(time.Now())
 	options := &storage.CacheOptions{
 		MaxAge: 500 * time.Millisecond,
+		Clock:  clock,
 	}
 
 	withCache(options, func(fs storage.FS, _ storage.FS, _ storage.FS) {
@@ -77,15 +79,19 @@ func TestCacheWrapper_CacheOptions_MaxAge(t *testing.T) {
 		f, err := fs.Open(ctx, "foo", nil)
 		assert.NoError(t, err)
 		assert.NotZero(t, f)
-		assert.NotZero(t, f.CreationTime)
-		assert.True(t, time.Since(f.CreationTime) < options.MaxAge, "file should not be expired")
+		assert.Equal(t, clock.Now(), f.CreationTime)
 
-		<-time.After(options.MaxAge)
+		clock.Advance(options.MaxAge)
 
 		f2, err := fs.Open(ctx, "foo", nil)
 		assert.NoError(t, err)
-		assert.NotZero(t, f2.CreationTime)
-		assert.True(t, f2.CreationTime.After(f.CreationTime)) // New cache
+		assert.Equal(t, f.CreationTime, f2.CreationTime) // Not expired yet
+
+		clock.Advance(time.Millisecond)
+
+		f3, err := fs.Open(ctx, "foo", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, clock.Now(), f3.CreationTime) // New cache
 	})
 }
 
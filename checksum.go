@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5" //nolint:gosec // MD5 is only used to check integrity.
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksummer computes the checksums of the content written to it.
+type checksummer struct {
+	md5    hash.Hash
+	crc32c hash.Hash32
+}
+
+func newChecksummer() *checksummer {
+	return &checksummer{
+		md5:    md5.New(), //nolint:gosec
+		crc32c: crc32.New(crc32cTable),
+	}
+}
+
+// Write implements io.Writer, it never returns an error.
+func (c *checksummer) Write(p []byte) (int, error) {
+	c.md5.Write(p)
+	c.crc32c.Write(p)
+
+	return len(p), nil
+}
+
+// setChecksums sets the checksums of the content written so far in attrs.
+func (c *checksummer) setChecksums(attrs *Attributes) {
+	attrs.MD5 = c.md5.Sum(nil)
+	attrs.CRC32C = c.crc32c.Sum(nil)
+}
+
+// verify returns a *ChecksumError if the content written so far doesn't match the known checksums of attrs.
+func (c *checksummer) verify(path string, attrs *Attributes) error {
+	var actual Attributes
+	c.setChecksums(&actual)
+
+	if attrs.MD5 != nil && !bytes.Equal(attrs.MD5, actual.MD5) {
+		return &ChecksumError{Path: path, Algorithm: "md5", Expected: attrs.MD5, Actual: actual.MD5}
+	}
+	if attrs.CRC32C != nil && !bytes.Equal(attrs.CRC32C, actual.CRC32C) {
+		return &ChecksumError{Path: path, Algorithm: "crc32c", Expected: attrs.CRC32C, Actual: actual.CRC32C}
+	}
+
+	return nil
+}
+
+// clearChecksums clears the checksums of attrs, for wrappers transforming the content.
+func clearChecksums(attrs *Attributes) {
+	attrs.MD5 = nil
+	attrs.CRC32C = nil
+}
+
+// checksumReadCloser verifies the checksums of the content when reaching EOF.
+type checksumReadCloser struct {
+	io.ReadCloser
+	path     string
+	expected Attributes
+	c        *checksummer
+}
+
+// verifyChecksums wraps rc so reading returns a *ChecksumError at EOF if the content doesn't match
+// the checksums of attrs.  rc is returned as is if attrs has no checksums.
+func verifyChecksums(path string, attrs Attributes, rc io.ReadCloser) io.ReadCloser {
+	if attrs.MD5 == nil && attrs.CRC32C == nil {
+		return rc
+	}
+
+	return &checksumReadCloser{
+		ReadCloser: rc,
+		path:       path,
+		expected:   attrs,
+		c:          newChecksummer(),
+	}
+}
+
+func (r *checksumReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.c.Write(p[:n])
+	if err == io.EOF { //nolint:errorlint // io.EOF is never wrapped by Read.
+		if err := r.c.verify(r.path, &r.expected); err != nil {
+			return n, err
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,122 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func checksums(content string) ([]byte, []byte) {
+	sum := md5.Sum([]byte(content)) //nolint:gosec
+	crc := crc32.Checksum([]byte(content), crc32.MakeTable(crc32.Castagnoli))
+
+	return sum[:], []byte{byte(crc >> 24), byte(crc >> 16), byte(crc >> 8), byte(crc)}
+}
+
+func TestChecksums(t *testing.T) {
+	ctx := context.Background()
+	md5Sum, crc := checksums("bar")
+
+	check := func(fs storage.FS) {
+		// Matching checksums
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), &storage.WriterOptions{
+			Attributes: storage.Attributes{MD5: md5Sum, CRC32C: crc},
+		}))
+
+		// Mismatching checksums
+		err := storage.Write(ctx, fs, "foo", []byte("baz"), &storage.WriterOptions{
+			Attributes: storage.Attributes{MD5: md5Sum},
+		})
+		assert.ErrorIs(t, err, storage.ErrChecksumMismatch)
+
+		var checksumErr *storage.ChecksumError
+		require.True(t, errors.As(err, &checksumErr))
+		assert.Equal(t, "md5", checksumErr.Algorithm)
+		assert.Equal(t, md5Sum, checksumErr.Expected)
+
+		// The file isn't written on mismatch
+		testutils.OpenExists(t, fs, "foo", "bar")
+		err = storage.Write(ctx, fs, "other", []byte("baz"), &storage.WriterOptions{
+			Attributes: storage.Attributes{MD5: md5Sum},
+		})
+		assert.ErrorIs(t, err, storage.ErrChecksumMismatch)
+		assert.False(t, storage.Exists(ctx, fs, "other"))
+	}
+
+	withMem(check)
+	withLocal(check)
+}
+
+func TestChecksums_memoryFS(t *testing.T) {
+	ctx := context.Background()
+	md5Sum, crc := checksums("bar")
+
+	withMem(func(fs storage.FS) {
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), nil))
+
+		attrs, err := fs.Attributes(ctx, "foo", nil)
+		require.NoError(t, err)
+		assert.Equal(t, md5Sum, attrs.MD5)
+		assert.Equal(t, crc, attrs.CRC32C)
+	})
+}
+
+func TestChecksums_localFS(t *testing.T) {
+	ctx := context.Background()
+
+	withLocal(func(fs storage.FS) {
+		require.NoError(t, storage.Write(ctx, fs, "dir/foo", []byte("bar"), nil))
+
+		// The checksums aren't stored, so they are unknown rather than computed from the content
+		attrs, err := fs.Attributes(ctx, "dir/foo", nil)
+		require.NoError(t, err)
+		assert.Nil(t, attrs.MD5)
+		assert.Nil(t, attrs.CRC32C)
+
+		_, err = fs.Attributes(ctx, "dir", nil)
+		assert.NoError(t, err)
+	})
+}
+
+func TestCacheWrapper_checksums(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(src storage.FS) {
+		withMem(func(cache storage.FS) {
+			require.NoError(t, storage.Write(ctx, src, "foo", []byte("bar"), nil))
+
+			// The content is corrupted while being read from the src
+			corrupted := storage.NewFaultWrapper(src, &storage.FaultRules{
+				Rules: []storage.FaultRule{{Ops: []storage.Op{storage.OpOpen}, Kind: storage.FaultCorrupt, Probability: 1}},
+			})
+			fs := storage.NewCacheWrapper(corrupted, cache, nil)
+
+			_, err := fs.Open(ctx, "foo", nil)
+			assert.ErrorIs(t, err, storage.ErrChecksumMismatch)
+
+			// Nothing is left in the cache
+			assert.False(t, storage.Exists(ctx, cache, "foo"))
+
+			// Without corruption, the checksums are cached too
+			fs = storage.NewCacheWrapper(src, cache, nil)
+			f, err := fs.Open(ctx, "foo", nil)
+			require.NoError(t, err)
+			_, err = io.ReadAll(f)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			md5Sum, crc := checksums("bar")
+			assert.Equal(t, md5Sum, f.MD5)
+			assert.Equal(t, crc, f.CRC32C)
+		})
+	})
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"time"
+)
+
+// Clock provides the time to FS implementations and wrappers, so it can be faked in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer creates a Timer sending the current time on its channel after d.
+	NewTimer(d time.Duration) Timer
+	// AfterFunc creates a Timer calling f after d.  Its channel is nil.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer created by a Clock, see time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// clockOrDefault returns clock, or the system clock if nil.
+func clockOrDefault(clock Clock) Clock {
+	if clock == nil {
+		return systemClock{}
+	}
+
+	return clock
+}
+
+// systemClock is the Clock of the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{t: time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{t: time.AfterFunc(d, f)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t systemTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+func (t systemTimer) Reset(d time.Duration) bool {
+	return t.t.Reset(d)
+}
@@ -2,9 +2,11 @@ package storage
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"sync"
 	"time"
 
@@ -105,29 +107,99 @@ func (c *cloudStorageFS) Attributes(ctx context.Context, path string, _ *ReaderO
 		ModTime:         a.Updated,
 		CreationTime:    a.Created,
 		Size:            a.Size,
+		MD5:             a.MD5,
+		CRC32C:          crc32cBytes(a.CRC32C),
 	}, nil
 }
 
-// Create implements FS.
+// isPreconditionFailed returns whether err is returned by Google Cloud Storage because a precondition of the
+// request failed, e.g. when closing a writer created with WriterOptions.IfNotExist if the path exists.
+func isPreconditionFailed(err error) bool {
+	var e *googleapi.Error
+
+	return errors.As(err, &e) && e.Code == http.StatusPreconditionFailed
+}
+
+func crc32cBytes(crc uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, crc)
+
+	return b
+}
+
+// Create implements FS.  The returned io.WriteCloser is a *storage.Writer.  Google Cloud Storage verifies
+// the checksums of the options when the writer is closed.
 func (c *cloudStorageFS) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
 	b, err := c.bucketHandle(ctx, ScopeWrite)
 	if err != nil {
 		return nil, err
 	}
 
-	w := b.Object(path).NewWriter(ctx)
+	obj := b.Object(path)
+	if options != nil && options.IfNotExist {
+		obj = obj.If(gstorage.Conditions{DoesNotExist: true})
+	}
+	w := obj.NewWriter(ctx)
 
 	if options != nil {
 		w.Metadata = options.Attributes.Metadata
 		w.ContentType = options.Attributes.ContentType
 		w.ContentEncoding = options.Attributes.ContentEncoding
 		w.ChunkSize = options.BufferSize
+
+		// Google Cloud Storage rejects the upload if the content doesn't match the checksums
+		w.MD5 = options.Attributes.MD5
+		if len(options.Attributes.CRC32C) == 4 {
+			w.CRC32C = binary.BigEndian.Uint32(options.Attributes.CRC32C)
+			w.SendCRC32C = true
+		}
 	}
 	w.ChunkSize = c.chunkSize(w.ChunkSize)
 
 	return w, nil
 }
 
+// updateMetadata implements metadataUpdater.  The update fails if the metadata changed concurrently.
+func (c *cloudStorageFS) updateMetadata(ctx context.Context, path string, edit func(map[string]string)) error {
+	b, err := c.bucketHandle(ctx, ScopeWrite)
+	if err != nil {
+		return err
+	}
+
+	obj := b.Object(path)
+	a, err := obj.Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, gstorage.ErrObjectNotExist) {
+			return &notExistError{
+				Path: path,
+			}
+		}
+
+		return err
+	}
+
+	metadata := make(map[string]string, len(a.Metadata))
+	for k, v := range a.Metadata {
+		metadata[k] = v
+	}
+	edit(metadata)
+	for k := range a.Metadata {
+		if _, ok := metadata[k]; !ok {
+			metadata[k] = "" // Deletes the key
+		}
+	}
+
+	_, err = obj.If(gstorage.Conditions{MetagenerationMatch: a.Metageneration}).Update(ctx, gstorage.ObjectAttrsToUpdate{
+		Metadata: metadata,
+	})
+	if isPreconditionFailed(err) {
+		// Not an existError
+		return fmt.Errorf("storage %s: metadata changed concurrently", path)
+	}
+
+	return err
+}
+
 func (c *cloudStorageFS) chunkSize(size int) int {
 	if size == 0 {
 		return googleapi.DefaultUploadChunkSize
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content encodings supported by NewCompressionWrapper.
+const (
+	ContentEncodingGzip = "gzip"
+	ContentEncodingZstd = "zstd"
+)
+
+// CompressionRule selects the encoding of the files matching it.
+type CompressionRule struct {
+	// Path is the glob pattern of the paths the rule applies to, see path.Match.
+	// A "**" segment matches any number of path segments.  If empty, it matches all paths.
+	Path string
+	// ContentType is the pattern of the content types the rule applies to, see path.Match (e.g. "text/*").
+	// If empty, it matches all content types.
+	ContentType string
+
+	// Encoding is the content encoding used to compress the files: ContentEncodingGzip or ContentEncodingZstd.
+	// If empty, the files are not compressed.
+	Encoding string
+}
+
+func (r *CompressionRule) matches(name string, attrs *Attributes) bool {
+	if !matchGlob(r.Path, name) {
+		return false
+	}
+	if r.ContentType == "" {
+		return true
+	}
+	ok, err := path.Match(r.ContentType, attrs.ContentType)
+
+	return err == nil && ok
+}
+
+// CompressionOptions are used to configure NewCompressionWrapper.
+type CompressionOptions struct {
+	// Rules select the encoding of each file on Create, the first matching rule is used.
+	// Files matching no rule are not compressed.
+	Rules []CompressionRule
+}
+
+// NewCompressionWrapper creates an FS which compresses files on Create according to options, setting
+// their Attributes.ContentEncoding, and decompresses files on Open according to their ContentEncoding.
+//
+// Create doesn't compress files when WriterOptions.Attributes.ContentEncoding is already set, since
+// the content is already encoded.
+// Open returns the content as stored if ReaderOptions.ReadCompressed is set.  Otherwise, it opens the
+// file with ReadCompressed so the content isn't also decompressed by the underlying FS (e.g. by Google
+// Cloud Storage transcoding).
+//
+// The Size of the Attributes is the size of the stored content, as the decompressed size isn't known.
+// The checksums are cleared for the same reason.
+func NewCompressionWrapper(fs FS, options *CompressionOptions) FS {
+	if options == nil {
+		options = &CompressionOptions{}
+	}
+
+	return &compressionWrapper{
+		fs:      fs,
+		options: options,
+	}
+}
+
+type compressionWrapper struct {
+	fs      FS
+	options *CompressionOptions
+}
+
+func (c *compressionWrapper) encoding(path string, attrs *Attributes) string {
+	for i := range c.options.Rules {
+		if r := &c.options.Rules[i]; r.matches(path, attrs) {
+			return r.Encoding
+		}
+	}
+
+	return ""
+}
+
+// decompressReadCloser closes both the decompressor and the underlying ReadCloser.
+type decompressReadCloser struct {
+	io.Reader
+	close func() error
+	rc    io.ReadCloser
+}
+
+func (r *decompressReadCloser) Close() error {
+	err := r.close()
+	if err1 := r.rc.Close(); err == nil {
+		err = err1
+	}
+
+	return err
+}
+
+func decompress(encoding string, rc io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case ContentEncodingGzip:
+		r, err := gzip.NewReader(rc)
+		if err != nil {
+			return nil, err
+		}
+
+		return &decompressReadCloser{Reader: r, close: r.Close, rc: rc}, nil
+	case ContentEncodingZstd:
+		r, err := zstd.NewReader(rc)
+		if err != nil {
+			return nil, err
+		}
+
+		return &decompressReadCloser{Reader: r, close: zstdCloser(r), rc: rc}, nil
+	}
+
+	return rc, nil
+}
+
+// zstdCloser adapts zstd.Decoder.Close, which doesn't return an error.
+func zstdCloser(d *zstd.Decoder) func() error {
+	return func() error {
+		d.Close()
+
+		return nil
+	}
+}
+
+// compressWriteCloser closes both the compressor and the underlying WriteCloser.
+type compressWriteCloser struct {
+	io.WriteCloser
+	wc io.WriteCloser
+}
+
+func (w *compressWriteCloser) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		_ = w.wc.Close()
+
+		return err
+	}
+
+	return w.wc.Close()
+}
+
+func compress(encoding string, wc io.WriteCloser) (io.WriteCloser, error) {
+	switch encoding {
+	case ContentEncodingGzip:
+		return &compressWriteCloser{WriteCloser: gzip.NewWriter(wc), wc: wc}, nil
+	case ContentEncodingZstd:
+		w, err := zstd.NewWriter(wc)
+		if err != nil {
+			return nil, err
+		}
+
+		return &compressWriteCloser{WriteCloser: w, wc: wc}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported content encoding: %q", encoding)
+}
+
+func isSupportedEncoding(encoding string) bool {
+	return encoding == ContentEncodingGzip || encoding == ContentEncodingZstd
+}
+
+// Open implements FS.
+func (c *compressionWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	if options != nil && options.ReadCompressed {
+		return c.fs.Open(ctx, path, options)
+	}
+
+	f, err := c.fs.Open(ctx, path, &ReaderOptions{ReadCompressed: true})
+	if err != nil {
+		return nil, err
+	}
+	if !isSupportedEncoding(f.ContentEncoding) {
+		return f, nil
+	}
+
+	rc, err := decompress(f.ContentEncoding, f.ReadCloser)
+	if err != nil {
+		_ = f.Close()
+
+		return nil, fmt.Errorf("storage %s: %w", path, err)
+	}
+	f.ReadCloser = rc
+	f.ContentEncoding = ""
+	clearChecksums(&f.Attributes)
+
+	return f, nil
+}
+
+// Attributes implements FS.  The ContentEncoding is cleared for files decompressed by Open.
+func (c *compressionWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	attrs, err := c.fs.Attributes(ctx, path, options)
+	if err != nil {
+		return nil, err
+	}
+	if (options == nil || !options.ReadCompressed) && isSupportedEncoding(attrs.ContentEncoding) {
+		attrs.ContentEncoding = ""
+		clearChecksums(attrs)
+	}
+
+	return attrs, nil
+}
+
+// Create implements FS.
+func (c *compressionWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	if options == nil {
+		options = &WriterOptions{}
+	}
+	if options.Attributes.ContentEncoding != "" {
+		return c.fs.Create(ctx, path, options)
+	}
+
+	encoding := c.encoding(path, &options.Attributes)
+	if encoding == "" {
+		return c.fs.Create(ctx, path, options)
+	}
+	if !isSupportedEncoding(encoding) {
+		return nil, fmt.Errorf("storage %s: unsupported content encoding: %q", path, encoding)
+	}
+
+	// Don't modify the options of the caller
+	compressedOptions := *options
+	compressedOptions.Attributes.ContentEncoding = encoding
+	compressedOptions.Attributes.Size = 0
+	clearChecksums(&compressedOptions.Attributes)
+
+	wc, err := c.fs.Create(ctx, path, &compressedOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := compress(encoding, wc)
+	if err != nil {
+		_ = wc.Close()
+
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Delete implements FS.
+func (c *compressionWrapper) Delete(ctx context.Context, path string) error {
+	return c.fs.Delete(ctx, path)
+}
+
+// Walk implements FS.
+func (c *compressionWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	return c.fs.Walk(ctx, path, fn)
+}
+
+func (c *compressionWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	// Pass-through
+	return c.fs.URL(ctx, path, options)
+}
@@ -0,0 +1,123 @@
+package storage_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func withCompression(cb func(fs storage.FS, src storage.FS)) {
+	withMem(func(src storage.FS) {
+		fs := storage.NewCompressionWrapper(src, &storage.CompressionOptions{
+			Rules: []storage.CompressionRule{
+				{Path: "**/*.json", Encoding: storage.ContentEncodingGzip},
+				{ContentType: "text/*", Encoding: storage.ContentEncodingZstd},
+			},
+		})
+		cb(fs, src)
+	})
+}
+
+func TestCompressionWrapper(t *testing.T) {
+	withCompression(func(fs storage.FS, _ storage.FS) {
+		testutils.Create(t, fs, "foo.json", "")
+		testutils.Create(t, fs, "foo.json", "bar")
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo.json")
+	})
+}
+
+func TestCompressionWrapper_encodings(t *testing.T) {
+	ctx := context.Background()
+	content := strings.Repeat(`{"foo": "bar"}`, 100)
+
+	tests := []struct {
+		path        string
+		contentType string
+		encoding    string
+		decode      func(io.Reader) ([]byte, error)
+	}{
+		{path: "a/b.json", encoding: storage.ContentEncodingGzip, decode: func(r io.Reader) ([]byte, error) {
+			gr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+
+			return io.ReadAll(gr)
+		}},
+		{path: "a/b.txt", contentType: "text/plain", encoding: storage.ContentEncodingZstd, decode: func(r io.Reader) ([]byte, error) {
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+
+			return io.ReadAll(zr)
+		}},
+		{path: "a/b.bin", decode: io.ReadAll},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			withCompression(func(fs storage.FS, src storage.FS) {
+				options := &storage.WriterOptions{Attributes: storage.Attributes{ContentType: tt.contentType}}
+				require.NoError(t, storage.Write(ctx, fs, tt.path, []byte(content), options))
+				assert.Empty(t, options.Attributes.ContentEncoding, "the options must not be modified")
+
+				raw, err := src.Open(ctx, tt.path, nil)
+				require.NoError(t, err)
+				assert.Equal(t, tt.encoding, raw.ContentEncoding)
+				decoded, err := tt.decode(raw)
+				require.NoError(t, err)
+				assert.Equal(t, content, string(decoded))
+
+				f, err := fs.Open(ctx, tt.path, nil)
+				require.NoError(t, err)
+				assert.Empty(t, f.ContentEncoding)
+				data, err := io.ReadAll(f)
+				require.NoError(t, err)
+				assert.Equal(t, content, string(data))
+				require.NoError(t, f.Close())
+
+				// ReadCompressed returns the content as stored
+				f, err = fs.Open(ctx, tt.path, &storage.ReaderOptions{ReadCompressed: true})
+				require.NoError(t, err)
+				assert.Equal(t, tt.encoding, f.ContentEncoding)
+				require.NoError(t, f.Close())
+			})
+		})
+	}
+}
+
+func TestCompressionWrapper_alreadyEncoded(t *testing.T) {
+	ctx := context.Background()
+
+	withCompression(func(fs storage.FS, src storage.FS) {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		_, err := gw.Write([]byte("bar"))
+		require.NoError(t, err)
+		require.NoError(t, gw.Close())
+
+		// Already gzipped content isn't compressed again
+		require.NoError(t, storage.Write(ctx, fs, "foo.json", buf.Bytes(), &storage.WriterOptions{
+			Attributes: storage.Attributes{ContentEncoding: storage.ContentEncodingGzip},
+		}))
+		raw, err := storage.Read(ctx, src, "foo.json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, buf.Bytes(), raw)
+
+		data, err := storage.Read(ctx, fs, "foo.json", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(data))
+	})
+}
@@ -0,0 +1,509 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// encryptionChunkSize is the size of the plaintext of each authenticated chunk.
+	encryptionChunkSize = 64 * 1024
+	// encryptionMaxChunkSize bounds the chunk size read from the metadata, which isn't authenticated,
+	// since a buffer of that size is allocated to decrypt the chunks.
+	encryptionMaxChunkSize = 16 * 1024 * 1024
+	// encryptionDataKeySize is the size of the AES-256 data keys.
+	encryptionDataKeySize = 32
+	// encryptionOverhead is the size of the AES-GCM tag added to each chunk.
+	encryptionOverhead = 16
+
+	metadataEncryptionKey       = "encryption-key"
+	metadataEncryptionKeyID     = "encryption-key-id"
+	metadataEncryptionChunkSize = "encryption-chunk-size"
+)
+
+// ErrNotEncrypted is returned when opening a file which was not written by an encryption wrapper.
+var ErrNotEncrypted = errors.New("file is not encrypted")
+
+// Keyring holds the master keys used to wrap (encrypt) the data keys of encrypted files.
+// It can be implemented with a KMS.
+type Keyring interface {
+	// Wrap encrypts dataKey with the current master key, and returns it with the ID of that master key.
+	Wrap(dataKey []byte) (wrapped []byte, keyID string, err error)
+	// Unwrap decrypts a data key which was wrapped with the master key keyID.
+	Unwrap(wrapped []byte, keyID string) ([]byte, error)
+}
+
+// NewStaticKeyring creates a Keyring from AES keys (16, 24 or 32 bytes long), indexed by key ID.
+// Data keys are wrapped with the key current.  Other keys are only used to unwrap data keys, so
+// files encrypted with them can still be read, and re-wrapped with RewrapEncryptionKey.
+func NewStaticKeyring(current string, keys map[string][]byte) (Keyring, error) {
+	k := &staticKeyring{
+		current: current,
+		aeads:   make(map[string]cipher.AEAD, len(keys)),
+	}
+	for id, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		k.aeads[id] = aead
+	}
+	if _, ok := k.aeads[current]; !ok {
+		return nil, fmt.Errorf("current key %s is not in the keyring", current)
+	}
+
+	return k, nil
+}
+
+type staticKeyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// Wrap implements Keyring.
+func (k *staticKeyring) Wrap(dataKey []byte) ([]byte, string, error) {
+	aead := k.aeads[k.current]
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(dataKey)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+
+	return aead.Seal(nonce, nonce, dataKey, []byte(k.current)), k.current, nil
+}
+
+// Unwrap implements Keyring.
+func (k *staticKeyring) Unwrap(wrapped []byte, keyID string) ([]byte, error) {
+	aead, ok := k.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %s", keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key is too short")
+	}
+
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, ciphertext, []byte(keyID))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// NewEncryptionWrapper creates an FS which encrypts files on Create, and decrypts them on Open.
+//
+// Each file is encrypted with its own data key, using AES-GCM in authenticated chunks so it can be
+// streamed.  The data key is wrapped with the current master key of keyring, and stored in the
+// Attributes.Metadata of the file along with the ID of the master key.  fs must therefore persist
+// Metadata (e.g. CloudStorageFS or MemoryFS).
+//
+// Walk and Delete are passed through, URL is not supported since it would expose the encrypted content.
+func NewEncryptionWrapper(fs FS, keyring Keyring) FS {
+	return &encryptionWrapper{
+		fs:      fs,
+		keyring: keyring,
+	}
+}
+
+type encryptionWrapper struct {
+	fs      FS
+	keyring Keyring
+}
+
+// encryptionHeader is the encryption metadata of a file.
+type encryptionHeader struct {
+	wrappedKey []byte
+	keyID      string
+	chunkSize  int
+}
+
+func parseEncryptionHeader(path string, metadata map[string]string) (*encryptionHeader, error) {
+	encodedKey, ok := metadata[metadataEncryptionKey]
+	if !ok {
+		return nil, fmt.Errorf("storage %s: %w", path, ErrNotEncrypted)
+	}
+
+	wrappedKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("storage %s: invalid encryption key: %w", path, err)
+	}
+
+	chunkSize, err := strconv.Atoi(metadata[metadataEncryptionChunkSize])
+	if err != nil || chunkSize <= 0 || chunkSize > encryptionMaxChunkSize {
+		return nil, fmt.Errorf("storage %s: invalid encryption chunk size: %q", path, metadata[metadataEncryptionChunkSize])
+	}
+
+	return &encryptionHeader{
+		wrappedKey: wrappedKey,
+		keyID:      metadata[metadataEncryptionKeyID],
+		chunkSize:  chunkSize,
+	}, nil
+}
+
+func (h *encryptionHeader) setMetadata(metadata map[string]string) {
+	metadata[metadataEncryptionKey] = base64.StdEncoding.EncodeToString(h.wrappedKey)
+	metadata[metadataEncryptionKeyID] = h.keyID
+	metadata[metadataEncryptionChunkSize] = strconv.Itoa(h.chunkSize)
+}
+
+// plaintextSize returns the size of the plaintext of an encrypted file of the given size.
+func (h *encryptionHeader) plaintextSize(size int64) int64 {
+	sealedChunkSize := int64(h.chunkSize + encryptionOverhead)
+	chunks := size/sealedChunkSize + 1 // The last chunk is always shorter than a full chunk
+
+	return size - chunks*encryptionOverhead
+}
+
+// plaintextAttributes returns a copy of attrs, describing the plaintext.
+func (h *encryptionHeader) plaintextAttributes(attrs Attributes) Attributes {
+	metadata := make(map[string]string, len(attrs.Metadata))
+	for k, v := range attrs.Metadata {
+		switch k {
+		case metadataEncryptionKey, metadataEncryptionKeyID, metadataEncryptionChunkSize:
+		default:
+			metadata[k] = v
+		}
+	}
+	attrs.Metadata = metadata
+	attrs.Size = h.plaintextSize(attrs.Size)
+	// The checksums are the ones of the encrypted content
+	clearChecksums(&attrs)
+
+	return attrs
+}
+
+// chunkNonce returns the nonce of the n-th chunk.  Data keys are never reused, so a counter is enough.
+func chunkNonce(aead cipher.AEAD, n uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], n)
+
+	return nonce
+}
+
+// chunkAdditionalData marks the last chunk, so truncating the file at a chunk boundary is detected.
+func chunkAdditionalData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+
+	return []byte{0}
+}
+
+type encryptWriter struct {
+	w         io.WriteCloser
+	aead      cipher.AEAD
+	chunkSize int
+
+	plaintext []byte
+	sealed    []byte
+	chunk     uint64
+}
+
+func (w *encryptWriter) seal(last bool) error {
+	w.sealed = w.aead.Seal(w.sealed[:0], chunkNonce(w.aead, w.chunk), w.plaintext, chunkAdditionalData(last))
+	w.chunk++
+	w.plaintext = w.plaintext[:0]
+
+	_, err := w.w.Write(w.sealed)
+
+	return err
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data comes in, since the last chunk has to be
+		// sealed differently.
+		if len(w.plaintext) == w.chunkSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := w.chunkSize - len(w.plaintext)
+		if n > len(p) {
+			n = len(p)
+		}
+		w.plaintext = append(w.plaintext, p[:n]...)
+		written += n
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+func (w *encryptWriter) Close() error {
+	if len(w.plaintext) == w.chunkSize {
+		if err := w.seal(false); err != nil {
+			_ = w.w.Close()
+
+			return err
+		}
+	}
+	if err := w.seal(true); err != nil {
+		_ = w.w.Close()
+
+		return err
+	}
+
+	return w.w.Close()
+}
+
+type decryptReader struct {
+	io.ReadCloser
+	path      string
+	aead      cipher.AEAD
+	chunkSize int
+
+	sealed    []byte
+	plaintext []byte
+	chunk     uint64
+	last      bool
+	err       error
+}
+
+func (r *decryptReader) open() error {
+	n, err := io.ReadFull(r.ReadCloser, r.sealed)
+	switch {
+	case err == nil:
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		// Only the last chunk is shorter than a full chunk
+		r.last = true
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("storage %s: missing last encrypted chunk: %w", r.path, io.ErrUnexpectedEOF)
+	default:
+		return err
+	}
+
+	plaintext, err := r.aead.Open(r.sealed[:0], chunkNonce(r.aead, r.chunk), r.sealed[:n], chunkAdditionalData(r.last))
+	if err != nil {
+		return fmt.Errorf("storage %s: decrypting chunk %d: %w", r.path, r.chunk, err)
+	}
+	r.chunk++
+	r.plaintext = plaintext
+
+	return nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plaintext) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.last {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			r.err = err
+		}
+	}
+
+	n := copy(p, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+
+	return n, nil
+}
+
+func (e *encryptionWrapper) header(ctx context.Context, path string, attrs Attributes) (*encryptionHeader, error) {
+	if _, ok := attrs.Metadata[metadataEncryptionKey]; !ok {
+		// Not all FS return the Metadata when opening a file
+		a, err := e.fs.Attributes(ctx, path, nil)
+		if err != nil {
+			return nil, err
+		}
+		attrs = *a
+	}
+
+	return parseEncryptionHeader(path, attrs.Metadata)
+}
+
+// Open implements FS.
+func (e *encryptionWrapper) Open(ctx context.Context, path string, _ *ReaderOptions) (*File, error) {
+	// Never let the underlying FS decode the content according to its ContentEncoding
+	f, err := e.fs.Open(ctx, path, &ReaderOptions{ReadCompressed: true})
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := e.header(ctx, path, f.Attributes)
+	if err != nil {
+		_ = f.Close()
+
+		return nil, err
+	}
+
+	dataKey, err := e.keyring.Unwrap(h.wrappedKey, h.keyID)
+	if err != nil {
+		_ = f.Close()
+
+		return nil, fmt.Errorf("storage %s: unwrapping data key: %w", path, err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		_ = f.Close()
+
+		return nil, err
+	}
+
+	return &File{
+		ReadCloser: &decryptReader{
+			ReadCloser: f.ReadCloser,
+			path:       path,
+			aead:       aead,
+			chunkSize:  h.chunkSize,
+			sealed:     make([]byte, h.chunkSize+aead.Overhead()),
+		},
+		Attributes: h.plaintextAttributes(f.Attributes),
+	}, nil
+}
+
+// Attributes implements FS.  The Size is the size of the plaintext.
+func (e *encryptionWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	attrs, err := e.fs.Attributes(ctx, path, options)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := parseEncryptionHeader(path, attrs.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintextAttrs := h.plaintextAttributes(*attrs)
+
+	return &plaintextAttrs, nil
+}
+
+// Create implements FS.
+func (e *encryptionWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	dataKey := make([]byte, encryptionDataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	wrappedKey, keyID, err := e.keyring.Wrap(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("storage %s: wrapping data key: %w", path, err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't modify the options of the caller
+	encryptedOptions := &WriterOptions{}
+	if options != nil {
+		*encryptedOptions = *options
+	}
+	encryptedOptions.Attributes.Size = 0
+	clearChecksums(&encryptedOptions.Attributes)
+	metadata := make(map[string]string, len(encryptedOptions.Attributes.Metadata)+3)
+	for k, v := range encryptedOptions.Attributes.Metadata {
+		metadata[k] = v
+	}
+	h := &encryptionHeader{
+		wrappedKey: wrappedKey,
+		keyID:      keyID,
+		chunkSize:  encryptionChunkSize,
+	}
+	h.setMetadata(metadata)
+	encryptedOptions.Attributes.Metadata = metadata
+
+	w, err := e.fs.Create(ctx, path, encryptedOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:         w,
+		aead:      aead,
+		chunkSize: encryptionChunkSize,
+		plaintext: make([]byte, 0, encryptionChunkSize),
+	}, nil
+}
+
+// Delete implements FS.
+func (e *encryptionWrapper) Delete(ctx context.Context, path string) error {
+	return e.fs.Delete(ctx, path)
+}
+
+// Walk implements FS.
+func (e *encryptionWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	return e.fs.Walk(ctx, path, fn)
+}
+
+// URL implements FS.  It is not supported, since the URL would serve the encrypted content.
+func (e *encryptionWrapper) URL(_ context.Context, _ string, _ *SignedURLOptions) (string, error) {
+	return "", ErrNotImplemented
+}
+
+// RewrapEncryptionKey re-wraps the data key of a file written by an encryption wrapper with the
+// current master key of keyring, e.g. after rotating master keys.  fs is the FS underlying the
+// encryption wrapper.
+//
+// The content is copied as is: it is not decrypted or re-encrypted.  It is copied to a temporary path
+// next to path first, which is kept if overwriting path fails, so a complete copy always exists.
+// Nothing is written if the data key is already wrapped with the current master key.
+func RewrapEncryptionKey(ctx context.Context, fs FS, keyring Keyring, path string) error {
+	attrs, err := fs.Attributes(ctx, path, nil)
+	if err != nil {
+		return err
+	}
+
+	h, err := parseEncryptionHeader(path, attrs.Metadata)
+	if err != nil {
+		return err
+	}
+
+	dataKey, err := keyring.Unwrap(h.wrappedKey, h.keyID)
+	if err != nil {
+		return fmt.Errorf("storage %s: unwrapping data key: %w", path, err)
+	}
+
+	wrappedKey, keyID, err := keyring.Wrap(dataKey)
+	if err != nil {
+		return fmt.Errorf("storage %s: wrapping data key: %w", path, err)
+	}
+	if keyID == h.keyID {
+		return nil
+	}
+
+	h.wrappedKey = wrappedKey
+	h.keyID = keyID
+	setHeader := func(metadata map[string]string) {
+		h.setMetadata(metadata)
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	tmp := path + ".rewrap-" + hex.EncodeToString(suffix)
+	if err := copyFile(ctx, fs, path, tmp, setHeader); err != nil {
+		_ = fs.Delete(ctx, tmp)
+
+		return err
+	}
+	if err := copyFile(ctx, fs, tmp, path, nil); err != nil {
+		return fmt.Errorf("storage %s: re-wrapped copy kept at %s: %w", path, tmp, err)
+	}
+
+	return fs.Delete(ctx, tmp)
+}
@@ -0,0 +1,184 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func newTestKeyring(t *testing.T, current string, ids ...string) storage.Keyring {
+	t.Helper()
+
+	keys := make(map[string][]byte, len(ids))
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[:1]), 32)
+	}
+	keyring, err := storage.NewStaticKeyring(current, keys)
+	require.NoError(t, err)
+
+	return keyring
+}
+
+func TestEncryptionWrapper(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		fs := storage.NewEncryptionWrapper(mem, newTestKeyring(t, "k1", "k1"))
+		testutils.Create(t, fs, "foo", "")
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+	})
+}
+
+func TestEncryptionWrapper_chunks(t *testing.T) {
+	ctx := context.Background()
+
+	// Sizes around the 64KiB chunk size
+	for _, size := range []int{16, 64 * 1024, 64*1024 + 1, 200 * 1024} {
+		withMem(func(mem storage.FS) {
+			fs := storage.NewEncryptionWrapper(mem, newTestKeyring(t, "k1", "k1"))
+
+			content := make([]byte, size)
+			_, err := rand.Read(content)
+			require.NoError(t, err)
+			require.NoError(t, storage.Write(ctx, fs, "foo", content, nil))
+
+			raw, err := storage.Read(ctx, mem, "foo", nil)
+			require.NoError(t, err)
+			assert.NotEqual(t, content, raw[:size])
+
+			got, err := storage.Read(ctx, fs, "foo", nil)
+			require.NoError(t, err)
+			assert.Equal(t, content, got)
+
+			attrs, err := fs.Attributes(ctx, "foo", nil)
+			require.NoError(t, err)
+			assert.Equal(t, int64(size), attrs.Size)
+			assert.Empty(t, attrs.Metadata)
+		})
+	}
+}
+
+func TestEncryptionWrapper_tampering(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		keyring := newTestKeyring(t, "k1", "k1")
+		require.NoError(t, storage.Write(ctx, storage.NewEncryptionWrapper(mem, keyring), "foo", []byte("bar"), nil))
+
+		corrupted := storage.NewFaultWrapper(mem, &storage.FaultRules{
+			Rules: []storage.FaultRule{{Kind: storage.FaultCorrupt, Probability: 1, Offset: 1}},
+		})
+		_, err := storage.Read(ctx, storage.NewEncryptionWrapper(corrupted, keyring), "foo", nil)
+		assert.ErrorContains(t, err, "message authentication failed")
+
+		_, err = storage.Read(ctx, storage.NewEncryptionWrapper(mem, newTestKeyring(t, "k2", "k2")), "foo", nil)
+		assert.ErrorContains(t, err, "unknown key k1")
+
+		require.NoError(t, storage.Write(ctx, mem, "plain", []byte("bar"), nil))
+		_, err = storage.Read(ctx, storage.NewEncryptionWrapper(mem, keyring), "plain", nil)
+		assert.ErrorIs(t, err, storage.ErrNotEncrypted)
+	})
+}
+
+func TestRewrapEncryptionKey(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		require.NoError(t, storage.Write(ctx, storage.NewEncryptionWrapper(mem, newTestKeyring(t, "k1", "k1")), "foo", []byte("bar"), nil))
+		ciphertext, err := storage.Read(ctx, mem, "foo", nil)
+		require.NoError(t, err)
+
+		// Rotate to k2
+		require.NoError(t, storage.RewrapEncryptionKey(ctx, mem, newTestKeyring(t, "k2", "k1", "k2"), "foo"))
+
+		attrs, err := mem.Attributes(ctx, "foo", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "k2", attrs.Metadata["encryption-key-id"])
+
+		rewrapped, err := storage.Read(ctx, mem, "foo", nil)
+		require.NoError(t, err)
+		assert.Equal(t, ciphertext, rewrapped, "the content must not be re-encrypted")
+
+		// k1 is no longer needed
+		data, err := storage.Read(ctx, storage.NewEncryptionWrapper(mem, newTestKeyring(t, "k2", "k2")), "foo", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(data))
+
+		paths, err := storage.List(ctx, mem, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo"}, paths, "the temporary copy must be deleted")
+	})
+}
+
+var errReadFailed = errors.New("read failed")
+
+// failingReadFS fails reading the content of the files it opens.
+type failingReadFS struct {
+	storage.FS
+}
+
+type failingReader struct {
+	io.ReadCloser
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, errReadFailed
+}
+
+func (f *failingReadFS) Open(ctx context.Context, path string, options *storage.ReaderOptions) (*storage.File, error) {
+	file, err := f.FS.Open(ctx, path, options)
+	if err != nil {
+		return nil, err
+	}
+	file.ReadCloser = &failingReader{file.ReadCloser}
+
+	return file, nil
+}
+
+func TestRewrapEncryptionKey_failedCopy(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		require.NoError(t, storage.Write(ctx, storage.NewEncryptionWrapper(mem, newTestKeyring(t, "k1", "k1")), "foo", []byte("bar"), nil))
+
+		err := storage.RewrapEncryptionKey(ctx, &failingReadFS{mem}, newTestKeyring(t, "k2", "k1", "k2"), "foo")
+		assert.ErrorIs(t, err, errReadFailed)
+
+		// The file is left untouched
+		data, err := storage.Read(ctx, storage.NewEncryptionWrapper(mem, newTestKeyring(t, "k1", "k1")), "foo", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(data))
+		paths, err := storage.List(ctx, mem, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo"}, paths)
+	})
+}
+
+func TestEncryptionWrapper_chunkSize(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		keyring := newTestKeyring(t, "k1", "k1")
+		require.NoError(t, storage.Write(ctx, storage.NewEncryptionWrapper(mem, keyring), "foo", []byte("bar"), nil))
+		attrs, err := mem.Attributes(ctx, "foo", nil)
+		require.NoError(t, err)
+		ciphertext, err := storage.Read(ctx, mem, "foo", nil)
+		require.NoError(t, err)
+
+		// A tampered chunk size is rejected before allocating a buffer of that size
+		attrs.Metadata["encryption-chunk-size"] = "2000000000"
+		require.NoError(t, storage.Write(ctx, mem, "foo", ciphertext, &storage.WriterOptions{
+			Attributes: storage.Attributes{Metadata: attrs.Metadata},
+		}))
+		_, err = storage.NewEncryptionWrapper(mem, keyring).Open(ctx, "foo", nil)
+		assert.ErrorContains(t, err, "invalid encryption chunk size")
+	})
+}
@@ -1,12 +1,21 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 )
 
 var ErrNotImplemented = errors.New("not implemented")
 
+// ErrChecksumMismatch is returned (wrapped in a *ChecksumError) when content doesn't match its checksums.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrPermissionDenied is returned (wrapped in a *PermissionError) when an operation is outside the
+// granted scopes.
+var ErrPermissionDenied = errors.New("permission denied")
+
 // isNotExister is an interface used to define the behaviour of errors resulting
 // from operations which report missing files/paths.
 type isNotExister interface {
@@ -36,3 +45,117 @@ func (e *notExistError) isNotExist() bool { return true }
 func (e *notExistError) Error() string {
 	return fmt.Sprintf("storage %v: path does not exist", e.Path)
 }
+
+// isExister is an interface used to define the behaviour of errors resulting
+// from operations which report existing files/paths.
+type isExister interface {
+	isExist() bool
+}
+
+// IsExist returns a boolean indicating whether the error is known to report that
+// a path already exists.
+func IsExist(err error) bool {
+	var e isExister
+	if err != nil && errors.As(err, &e) {
+		return e.isExist()
+	}
+
+	// Closing a writer of Google Cloud Storage created with WriterOptions.IfNotExist
+	return isPreconditionFailed(err)
+}
+
+// existError is returned from FS.Create implementations when WriterOptions.IfNotExist
+// is set and the path already exists.
+type existError struct {
+	Path string
+}
+
+func (e *existError) isExist() bool { return true }
+
+// Error implements error
+func (e *existError) Error() string {
+	return fmt.Sprintf("storage %v: path already exists", e.Path)
+}
+
+// ChecksumError is returned when the content of a path doesn't match its checksum.
+// It wraps ErrChecksumMismatch.
+type ChecksumError struct {
+	Path string
+	// Algorithm is the checksum which doesn't match: "md5" or "crc32c".
+	Algorithm string
+	Expected  []byte
+	Actual    []byte
+}
+
+// Error implements error
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("storage %v: %v %v: expected %x, got %x", e.Path, e.Algorithm, ErrChecksumMismatch, e.Expected, e.Actual)
+}
+
+// Unwrap returns ErrChecksumMismatch.
+func (e *ChecksumError) Unwrap() error { return ErrChecksumMismatch }
+
+// PermissionError is returned when an operation on a path is not permitted.
+// It wraps ErrPermissionDenied.
+type PermissionError struct {
+	Path string
+	Op   Op
+	// Scope is the scope required by the operation.
+	Scope Scope
+}
+
+// Error implements error
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("storage %v: %v: %v requires %v scope", e.Path, ErrPermissionDenied, e.Op, e.Scope)
+}
+
+// Unwrap returns ErrPermissionDenied.
+func (e *PermissionError) Unwrap() error { return ErrPermissionDenied }
+
+// HTTPStatus returns the HTTP status code of err, for handlers serving an FS: 404 if the path doesn't exist,
+// 412 if it exists, 403 if the operation or the signed URL isn't allowed, 409 if the file is locked, 400 if
+// the content doesn't match its checksums, 501 if not implemented and 500 otherwise.
+func HTTPStatus(err error) int {
+	switch {
+	case IsNotExist(err):
+		return http.StatusNotFound
+	case IsExist(err):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrPermissionDenied), errors.Is(err, ErrInvalidSignedURL):
+		return http.StatusForbidden
+	case errors.Is(err, ErrObjectLocked):
+		return http.StatusConflict
+	case errors.Is(err, ErrChecksumMismatch):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotImplemented):
+		return http.StatusNotImplemented
+	}
+
+	return http.StatusInternalServerError
+}
+
+// errorClass returns a short, stable name of the kind of err, for logs and metrics.
+func errorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case IsNotExist(err):
+		return "not_exist"
+	case IsExist(err):
+		return "exist"
+	case errors.Is(err, ErrPermissionDenied):
+		return "permission_denied"
+	case errors.Is(err, ErrChecksumMismatch):
+		return "checksum_mismatch"
+	case errors.Is(err, ErrObjectLocked):
+		return "locked"
+	case errors.Is(err, ErrNotImplemented):
+		return "not_implemented"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	}
+
+	return "other"
+}
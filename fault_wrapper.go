@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+)
+
+// ErrInjectedFault is the error returned by faults injected by NewFaultWrapper when FaultRule.Err is nil.
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultKind is the kind of fault injected by a FaultRule.
+type FaultKind int
+
+const (
+	// FaultError makes the operation return FaultRule.Err.
+	FaultError FaultKind = iota
+	// FaultNotExist makes the operation report that the path does not exist.
+	FaultNotExist
+	// FaultStall blocks the operation until its context is done.
+	FaultStall
+	// FaultTruncate makes reading a File opened by Open stop silently after FaultRule.Offset bytes.
+	FaultTruncate
+	// FaultCorrupt flips the bits of the byte at FaultRule.Offset when reading a File opened by Open.
+	FaultCorrupt
+	// FaultCloseError makes Close on a writer returned by Create return FaultRule.Err.
+	// The context of the underlying writer is cancelled before closing it, so backends honouring it
+	// abort the write.  Others still write the file, which simulates an ambiguous failure.
+	FaultCloseError
+	// FaultDropWalk skips the matching paths when walking.
+	FaultDropWalk
+)
+
+// FaultRule describes a fault to inject and where to inject it.
+type FaultRule struct {
+	// Ops are the operations the fault is injected in.  If empty, it applies to all operations supporting Kind.
+	Ops []Op
+	// Path is the glob pattern of the paths the fault is injected for, see path.Match.
+	// A "**" segment matches any number of path segments.  If empty, it matches all paths.
+	// For FaultDropWalk, it is matched against each walked path, otherwise against the path of the operation.
+	Path string
+	// Probability is the probability of injecting the fault, between 0 and 1: 1 always injects it,
+	// 0 never does, which disables the rule.
+	Probability float64
+
+	Kind FaultKind
+	// Err is the error returned by FaultError and FaultCloseError.  Defaults to ErrInjectedFault.
+	Err error
+	// Offset is the offset used by FaultTruncate and FaultCorrupt.
+	Offset int64
+}
+
+func (r *FaultRule) err() error {
+	if r.Err == nil {
+		return ErrInjectedFault
+	}
+
+	return r.Err
+}
+
+// supports returns whether the Kind of the rule can be injected in op.
+func (r *FaultRule) supports(op Op) bool {
+	switch r.Kind {
+	case FaultError, FaultNotExist, FaultStall:
+		return true
+	case FaultTruncate, FaultCorrupt:
+		return op == OpOpen
+	case FaultCloseError:
+		return op == OpCreate
+	case FaultDropWalk:
+		return op == OpWalk
+	}
+
+	return false
+}
+
+func (r *FaultRule) applies(op Op, path string) bool {
+	if !r.supports(op) {
+		return false
+	}
+	if len(r.Ops) > 0 {
+		found := false
+		for _, o := range r.Ops {
+			if o == op {
+				found = true
+
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return matchGlob(r.Path, path)
+}
+
+// FaultRules are used to configure NewFaultWrapper.
+type FaultRules struct {
+	// Rules are evaluated in order, the first matching rule which fires is injected.
+	Rules []FaultRule
+	// Seed seeds the random number generator deciding whether a fault fires,
+	// so a sequence of calls always injects the same faults.
+	Seed int64
+}
+
+// NewFaultWrapper creates an FS which injects faults into operations, according to rules.
+// Probably only useful for testing.
+func NewFaultWrapper(fs FS, rules *FaultRules) FS {
+	if rules == nil {
+		rules = &FaultRules{}
+	}
+
+	return &faultWrapper{
+		fs:    fs,
+		rules: rules.Rules,
+		rand:  rand.New(rand.NewSource(rules.Seed)), //nolint:gosec // Determinism is the point.
+	}
+}
+
+type faultWrapper struct {
+	fs    FS
+	rules []FaultRule
+
+	randLock sync.Mutex
+	rand     *rand.Rand
+}
+
+// fault returns the fault to inject for op on path, or nil.  Rules are filtered by filter.
+func (f *faultWrapper) fault(op Op, path string, filter func(*FaultRule) bool) *FaultRule {
+	for i := range f.rules {
+		r := &f.rules[i]
+		if !filter(r) || !r.applies(op, path) {
+			continue
+		}
+		if r.Probability <= 0 {
+			continue
+		}
+		if r.Probability >= 1 {
+			return r
+		}
+
+		f.randLock.Lock()
+		fire := f.rand.Float64() < r.Probability
+		f.randLock.Unlock()
+		if fire {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// inject injects a fault which fails the operation.  It returns nil if the operation can go ahead,
+// possibly with the returned rule for faults such as FaultTruncate.
+func (f *faultWrapper) inject(ctx context.Context, op Op, path string) (*FaultRule, error) {
+	r := f.fault(op, path, func(r *FaultRule) bool { return r.Kind != FaultDropWalk })
+	if r == nil {
+		return nil, nil
+	}
+
+	switch r.Kind {
+	case FaultError:
+		return nil, r.err()
+	case FaultNotExist:
+		return nil, &notExistError{
+			Path: path,
+		}
+	case FaultStall:
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	case FaultTruncate, FaultCorrupt, FaultCloseError, FaultDropWalk:
+	}
+
+	return r, nil
+}
+
+type faultReadCloser struct {
+	io.ReadCloser
+	rule   *FaultRule
+	offset int64
+}
+
+func (r *faultReadCloser) Read(p []byte) (int, error) {
+	if r.rule.Kind == FaultTruncate {
+		if r.offset >= r.rule.Offset {
+			return 0, io.EOF
+		}
+		if remaining := r.rule.Offset - r.offset; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	if r.rule.Kind == FaultCorrupt && r.offset <= r.rule.Offset && r.rule.Offset < r.offset+int64(n) {
+		p[r.rule.Offset-r.offset] ^= 0xff
+	}
+	r.offset += int64(n)
+
+	return n, err
+}
+
+type faultWriteCloser struct {
+	io.WriteCloser
+	rule   *FaultRule
+	cancel context.CancelFunc
+}
+
+func (w *faultWriteCloser) Close() error {
+	w.cancel()
+	_ = w.WriteCloser.Close()
+
+	return w.rule.err()
+}
+
+// Open implements FS.
+func (f *faultWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	r, err := f.inject(ctx, OpOpen, path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := f.fs.Open(ctx, path, options)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		file.ReadCloser = &faultReadCloser{
+			ReadCloser: file.ReadCloser,
+			rule:       r,
+		}
+	}
+
+	return file, nil
+}
+
+// Attributes implements FS.
+func (f *faultWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	if _, err := f.inject(ctx, OpAttributes, path); err != nil {
+		return nil, err
+	}
+
+	return f.fs.Attributes(ctx, path, options)
+}
+
+// Create implements FS.
+func (f *faultWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	r, err := f.inject(ctx, OpCreate, path)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return f.fs.Create(ctx, path, options)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w, err := f.fs.Create(ctx, path, options)
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	return &faultWriteCloser{
+		WriteCloser: w,
+		rule:        r,
+		cancel:      cancel,
+	}, nil
+}
+
+// Delete implements FS.
+func (f *faultWrapper) Delete(ctx context.Context, path string) error {
+	if _, err := f.inject(ctx, OpDelete, path); err != nil {
+		return err
+	}
+
+	return f.fs.Delete(ctx, path)
+}
+
+// Walk implements FS.
+func (f *faultWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	if _, err := f.inject(ctx, OpWalk, path); err != nil {
+		return err
+	}
+
+	return f.fs.Walk(ctx, path, func(path string) error {
+		if f.fault(OpWalk, path, func(r *FaultRule) bool { return r.Kind == FaultDropWalk }) != nil {
+			return nil
+		}
+
+		return fn(path)
+	})
+}
+
+// URL implements FS.
+func (f *faultWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	if _, err := f.inject(ctx, OpURL, path); err != nil {
+		return "", err
+	}
+
+	return f.fs.URL(ctx, path, options)
+}
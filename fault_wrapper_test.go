@@ -0,0 +1,128 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func withFaults(rules []storage.FaultRule, cb func(fs storage.FS, src storage.FS)) {
+	withMem(func(src storage.FS) {
+		cb(storage.NewFaultWrapper(src, &storage.FaultRules{Rules: rules}), src)
+	})
+}
+
+func TestFaultWrapper(t *testing.T) {
+	withFaults(nil, func(fs storage.FS, _ storage.FS) {
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+	})
+}
+
+func TestFaultWrapper_errors(t *testing.T) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+
+	withFaults([]storage.FaultRule{
+		{Ops: []storage.Op{storage.OpOpen}, Path: "missing/**", Kind: storage.FaultNotExist, Probability: 1},
+		{Ops: []storage.Op{storage.OpDelete}, Kind: storage.FaultError, Probability: 1, Err: errBoom},
+		{Ops: []storage.Op{storage.OpAttributes}, Kind: storage.FaultStall, Probability: 1},
+		{Ops: []storage.Op{storage.OpCreate}, Path: "unclosable", Kind: storage.FaultCloseError, Probability: 1},
+	}, func(fs storage.FS, src storage.FS) {
+		testutils.Create(t, src, "missing/foo", "bar")
+
+		_, err := fs.Open(ctx, "missing/foo", nil)
+		assert.True(t, storage.IsNotExist(err))
+
+		assert.ErrorIs(t, fs.Delete(ctx, "missing/foo"), errBoom)
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = fs.Attributes(timeoutCtx, "missing/foo", nil)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		err = storage.Write(ctx, fs, "unclosable", []byte("bar"), nil)
+		assert.ErrorIs(t, err, storage.ErrInjectedFault)
+	})
+}
+
+func TestFaultWrapper_reads(t *testing.T) {
+	ctx := context.Background()
+
+	withFaults([]storage.FaultRule{
+		{Path: "truncated", Kind: storage.FaultTruncate, Probability: 1, Offset: 2},
+		{Path: "corrupted", Kind: storage.FaultCorrupt, Probability: 1, Offset: 1},
+	}, func(fs storage.FS, src storage.FS) {
+		testutils.Create(t, src, "truncated", "foobar")
+		testutils.Create(t, src, "corrupted", "foobar")
+
+		data, err := storage.Read(ctx, fs, "truncated", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "fo", string(data))
+
+		data, err = storage.Read(ctx, fs, "corrupted", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{'f', 'o' ^ 0xff, 'o', 'b', 'a', 'r'}, data)
+	})
+}
+
+func TestFaultWrapper_Walk(t *testing.T) {
+	ctx := context.Background()
+
+	withFaults([]storage.FaultRule{
+		{Path: "dropped/*", Kind: storage.FaultDropWalk, Probability: 1},
+	}, func(fs storage.FS, src storage.FS) {
+		testutils.Create(t, src, "dropped/foo", "bar")
+		testutils.Create(t, src, "kept/foo", "bar")
+
+		list, err := storage.List(ctx, fs, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"kept/foo"}, list)
+	})
+}
+
+func TestFaultWrapper_Probability(t *testing.T) {
+	ctx := context.Background()
+	rules := &storage.FaultRules{
+		Rules: []storage.FaultRule{{Kind: storage.FaultError, Probability: 0.5}},
+		Seed:  42,
+	}
+	run := func() []bool {
+		var failed []bool
+		withMem(func(mem storage.FS) {
+			fs := storage.NewFaultWrapper(mem, rules)
+			for i := 0; i < 20; i++ {
+				failed = append(failed, fs.Delete(ctx, "foo") != nil)
+			}
+		})
+
+		return failed
+	}
+
+	failed := run()
+	assert.Contains(t, failed, true)
+	assert.Contains(t, failed, false)
+	assert.Equal(t, failed, run(), "the same seed must inject the same faults")
+}
+
+func TestFaultWrapper_ZeroProbability(t *testing.T) {
+	ctx := context.Background()
+	withMem(func(mem storage.FS) {
+		fs := storage.NewFaultWrapper(mem, &storage.FaultRules{
+			Rules: []storage.FaultRule{
+				{Ops: []storage.Op{storage.OpDelete}, Kind: storage.FaultError},
+				{Ops: []storage.Op{storage.OpDelete}, Kind: storage.FaultNotExist, Probability: 0},
+			},
+		})
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("foo"), nil))
+
+		assert.NoError(t, fs.Delete(ctx, "foo"), "rules with a zero probability must never fire")
+	})
+}
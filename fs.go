@@ -34,6 +34,12 @@ type Attributes struct {
 	CreationTime time.Time
 	// Size is the size of the object in bytes.
 	Size int64
+	// MD5 is the MD5 hash of the content, if known.  It is not known by localFS, by Open on Google Cloud
+	// Storage, nor for composite objects of Google Cloud Storage.
+	MD5 []byte
+	// CRC32C is the CRC32 checksum of the content, using the Castagnoli polynomial, in big-endian order, if known.
+	// It is not known by localFS, nor by Open on Google Cloud Storage.
+	CRC32C []byte
 }
 
 // ReaderOptions are used to modify the behaviour of read operations.
@@ -52,6 +58,10 @@ type ReaderOptions struct {
 type WriterOptions struct {
 	Attributes Attributes
 
+	// IfNotExist makes the write fail if the path already exists, the error satisfies IsExist.
+	// The check is atomic with the write on all the FS of this package.
+	IfNotExist bool
+
 	// BufferSize changes the default size in bytes of the chunks that
 	// Writer will upload in a single request; larger blobs will be split into
 	// multiple requests.
@@ -92,6 +102,18 @@ func (o *SignedURLOptions) applyDefaults() {
 	}
 }
 
+// Op identifies an FS operation.
+type Op string
+
+const (
+	OpOpen       Op = "open"
+	OpAttributes Op = "attrs"
+	OpCreate     Op = "create"
+	OpDelete     Op = "delete"
+	OpWalk       Op = "walk"
+	OpURL        Op = "url"
+)
+
 // FS is an interface which defines a virtual filesystem.
 type FS interface {
 	Walker
@@ -105,7 +127,8 @@ type FS interface {
 
 	// Create makes a new file at path in the filesystem.  Callers must close the
 	// returned WriteCloser and check the error to be sure that the file
-	// was successfully written.
+	// was successfully written.  If ctx is done when closing it, the write is aborted:
+	// the file isn't written, see AbortWrite.
 	Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error)
 
 	// Delete removes a path from the filesystem.
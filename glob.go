@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"path"
+	"strings"
+)
+
+// matchGlob reports whether name matches the shell pattern, as defined by path.Match.
+// In addition, a "**" segment matches any number of path segments, including none.
+// An empty pattern matches everything.
+func matchGlob(pattern string, name string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// validateGlob returns path.ErrBadPattern if pattern is malformed.
+func validateGlob(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_matchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{pattern: "", name: "foo", match: true},
+		{pattern: "foo", name: "foo", match: true},
+		{pattern: "foo", name: "foo/bar", match: false},
+		{pattern: "foo/*", name: "foo/bar", match: true},
+		{pattern: "foo/*", name: "foo/bar/baz", match: false},
+		{pattern: "foo/**", name: "foo/bar/baz", match: true},
+		{pattern: "foo/**", name: "foo", match: true},
+		{pattern: "**/*.json", name: "foo/bar/baz.json", match: true},
+		{pattern: "**/*.json", name: "baz.json", match: true},
+		{pattern: "**/*.json", name: "foo/baz.txt", match: false},
+		{pattern: "foo/**/baz", name: "foo/a/b/baz", match: true},
+		{pattern: "[", name: "[", match: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+","+tt.name, func(t *testing.T) {
+			require.Equal(t, tt.match, matchGlob(tt.pattern, tt.name))
+		})
+	}
+}
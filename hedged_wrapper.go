@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultHedgeDelay is the default duration for HedgeOptions.Delay.
+const DefaultHedgeDelay = 100 * time.Millisecond
+
+// defaultHedgeSamples is the number of latencies kept per operation when using HedgeOptions.Percentile.
+const defaultHedgeSamples = 1000
+
+// HedgeOptions are used to configure NewHedgedWrapper.
+type HedgeOptions struct {
+	// Delay is how long to wait for the first attempt before sending a second, identical one.
+	// Defaults to DefaultHedgeDelay.
+	Delay time.Duration
+
+	// Percentile, if set (e.g. 0.95), uses that percentile of the observed latency of the operation
+	// as the delay instead of Delay.  Delay is still used until MinSamples latencies have been observed.
+	Percentile float64
+
+	// MinSamples is the number of observed latencies required before Percentile is used.
+	MinSamples int
+}
+
+func (o *HedgeOptions) applyDefaults() {
+	if o.Delay == 0 {
+		o.Delay = DefaultHedgeDelay
+	}
+}
+
+// NewHedgedWrapper creates an FS which reduces tail latency by sending a second, identical request
+// when the first one is slow, returning whichever finishes first.
+// The loser is cancelled, and its File is closed if it still resolves.
+//
+// Only idempotent operations are hedged: Open and Attributes.
+// Create, Delete, Walk and URL are passed through.
+func NewHedgedWrapper(fs FS, options *HedgeOptions) FS {
+	// Don't modify the options of the caller
+	hedgeOptions := &HedgeOptions{}
+	if options != nil {
+		*hedgeOptions = *options
+	}
+	hedgeOptions.applyDefaults()
+
+	return &hedgedWrapper{
+		fs:      fs,
+		options: hedgeOptions,
+		open:    &latencyTracker{},
+		attrs:   &latencyTracker{},
+	}
+}
+
+type hedgedWrapper struct {
+	fs      FS
+	options *HedgeOptions
+
+	open  *latencyTracker
+	attrs *latencyTracker
+}
+
+// latencyTracker keeps the most recent latencies of an operation.
+type latencyTracker struct {
+	sync.Mutex
+
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencyTracker) record(d time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.samples) < defaultHedgeSamples {
+		l.samples = append(l.samples, d)
+
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % defaultHedgeSamples
+}
+
+// percentile returns the p-th percentile of the recorded latencies, and false if there are fewer than
+// minSamples samples.
+func (l *latencyTracker) percentile(p float64, minSamples int) (time.Duration, bool) {
+	l.Lock()
+	if len(l.samples) == 0 || len(l.samples) < minSamples {
+		l.Unlock()
+
+		return 0, false
+	}
+	samples := make([]time.Duration, len(l.samples))
+	copy(samples, l.samples)
+	l.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	i := int(p * float64(len(samples)))
+	if i >= len(samples) {
+		i = len(samples) - 1
+	}
+
+	return samples[i], true
+}
+
+func (h *hedgedWrapper) delay(l *latencyTracker) time.Duration {
+	if h.options.Percentile > 0 {
+		if d, ok := l.percentile(h.options.Percentile, h.options.MinSamples); ok {
+			return d
+		}
+	}
+
+	return h.options.Delay
+}
+
+type hedgeResult struct {
+	out    interface{}
+	err    error
+	cancel context.CancelFunc
+}
+
+// hedgeCall runs call, and runs it again if it hasn't returned after the hedging delay.
+// The first successful result is returned along with the cancel func of its context, which the caller
+// must call once the result is no longer in use.
+// Every other attempt is cancelled, and discard is called on any successful result arriving late.
+func (h *hedgedWrapper) hedgeCall(ctx context.Context, l *latencyTracker, call func(context.Context) (interface{}, error), discard func(interface{})) (interface{}, context.CancelFunc, error) {
+	results := make(chan hedgeResult, 2)
+	start := func() {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			begin := time.Now()
+			out, err := call(attemptCtx)
+			if err == nil {
+				l.record(time.Since(begin))
+			}
+			results <- hedgeResult{out: out, err: err, cancel: cancel}
+		}()
+	}
+
+	start()
+	pending := 1
+
+	timer := time.NewTimer(h.delay(l))
+	defer timer.Stop()
+
+	var res hedgeResult
+	for {
+		select {
+		case <-timer.C:
+			start()
+			pending++
+
+			continue
+		case res = <-results:
+			pending--
+		}
+
+		// An error is only returned once no other attempt is in flight.  If the first attempt fails
+		// before the hedging delay, no second attempt is sent.
+		if res.err == nil || pending == 0 {
+			break
+		}
+		res.cancel()
+	}
+
+	if pending > 0 {
+		go func() {
+			for ; pending > 0; pending-- {
+				late := <-results
+				if late.err == nil {
+					discard(late.out)
+				}
+				late.cancel()
+			}
+		}()
+	}
+
+	if res.err != nil {
+		res.cancel()
+
+		return nil, nil, res.err
+	}
+
+	return res.out, res.cancel, nil
+}
+
+// hedgedFile cancels the context of the winning attempt when the File is closed.
+type hedgedFile struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (f *hedgedFile) Close() error {
+	defer f.cancel()
+
+	return f.ReadCloser.Close()
+}
+
+// Open implements FS.
+func (h *hedgedWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	out, cancel, err := h.hedgeCall(ctx, h.open, func(ctx context.Context) (interface{}, error) {
+		return h.fs.Open(ctx, path, options)
+	}, func(out interface{}) {
+		if f, ok := out.(*File); ok && f != nil {
+			_ = f.Close()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f := out.(*File)
+	f.ReadCloser = &hedgedFile{
+		ReadCloser: f.ReadCloser,
+		cancel:     cancel,
+	}
+
+	return f, nil
+}
+
+// Attributes implements FS.
+func (h *hedgedWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	out, cancel, err := h.hedgeCall(ctx, h.attrs, func(ctx context.Context) (interface{}, error) {
+		return h.fs.Attributes(ctx, path, options)
+	}, func(interface{}) {})
+	if err != nil {
+		return nil, err
+	}
+	cancel()
+
+	return out.(*Attributes), nil
+}
+
+// Create implements FS.  Create is not idempotent, so it is not hedged.
+func (h *hedgedWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	return h.fs.Create(ctx, path, options)
+}
+
+// Delete implements FS.  Delete is not hedged.
+func (h *hedgedWrapper) Delete(ctx context.Context, path string) error {
+	return h.fs.Delete(ctx, path)
+}
+
+// Walk implements FS.  Walk calls fn for every path, so it is not hedged.
+func (h *hedgedWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	return h.fs.Walk(ctx, path, fn)
+}
+
+func (h *hedgedWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	// Pass-through
+	return h.fs.URL(ctx, path, options)
+}
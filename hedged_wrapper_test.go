@@ -0,0 +1,81 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+type closeRecorder struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed.Store(true)
+
+	return nil
+}
+
+func TestHedgedWrapper(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		fs := storage.NewHedgedWrapper(mem, nil)
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+		testutils.OpenNotExists(t, fs, "foo")
+	})
+}
+
+func TestHedgedWrapper_options(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		options := &storage.HedgeOptions{}
+		_ = storage.NewHedgedWrapper(mem, options)
+		assert.Equal(t, &storage.HedgeOptions{}, options, "the options of the caller are not modified")
+	})
+}
+
+func TestHedgedWrapper_Open_slow(t *testing.T) {
+	ctx := context.Background()
+	slow := &closeRecorder{Reader: strings.NewReader("slow")}
+	fast := &closeRecorder{Reader: strings.NewReader("fast")}
+
+	mockFS := storage.NewMockFS()
+	mockFS.On("Open", mock.Anything, "foo", mock.Anything).After(slowDelay).Return(&storage.File{ReadCloser: slow}, nil).Once()
+	mockFS.On("Open", mock.Anything, "foo", mock.Anything).Return(&storage.File{ReadCloser: fast}, nil).Once()
+
+	fs := storage.NewHedgedWrapper(mockFS, &storage.HedgeOptions{Delay: 10 * time.Millisecond})
+
+	start := time.Now()
+	f, err := fs.Open(ctx, "foo", nil)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), slowDelay)
+
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "fast", string(b))
+	require.NoError(t, f.Close())
+	assert.True(t, fast.closed.Load())
+
+	// The loser is closed once it resolves
+	assert.Eventually(t, slow.closed.Load, 2*slowDelay, 10*time.Millisecond)
+	mockFS.AssertExpectations(t)
+}
+
+func TestHedgedWrapper_Open_notExist(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		fs := storage.NewHedgedWrapper(mem, &storage.HedgeOptions{Delay: time.Hour})
+
+		_, err := fs.Open(context.Background(), "foo", nil)
+		assert.True(t, storage.IsNotExist(err))
+	})
+}
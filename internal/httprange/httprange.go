@@ -0,0 +1,56 @@
+// Package httprange parses the Range header of HTTP requests.
+package httprange
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsatisfiable is returned by Parse when the range can't be satisfied.
+var ErrUnsatisfiable = errors.New("invalid range")
+
+// Parse parses a single byte range of the Range header of a content of size bytes, returning the start and
+// length of the range.  ok is false if the header should be ignored, e.g. for multiple ranges, and err is
+// ErrUnsatisfiable if the range can't be satisfied.
+func Parse(header string, size int64) (start, length int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	if first == "" {
+		// Suffix range
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false, ErrUnsatisfiable
+		}
+		if n > size {
+			n = size
+		}
+
+		return size - n, n, true, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false, ErrUnsatisfiable
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, ErrUnsatisfiable
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return start, end - start + 1, true, nil
+}
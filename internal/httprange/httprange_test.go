@@ -0,0 +1,41 @@
+package httprange_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Shopify/go-storage/internal/httprange"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		header        string
+		size          int64
+		start, length int64
+		ok            bool
+		err           error
+	}{
+		{header: "bytes=2-4", size: 10, start: 2, length: 3, ok: true},
+		{header: "bytes=2-", size: 10, start: 2, length: 8, ok: true},
+		{header: "bytes=5-20", size: 10, start: 5, length: 5, ok: true},
+		{header: "bytes=-3", size: 10, start: 7, length: 3, ok: true},
+		{header: "bytes=-20", size: 10, start: 0, length: 10, ok: true},
+		{header: "bytes=0-1,4-5", size: 10},
+		{header: "items=0-1", size: 10},
+		{header: "bytes=3", size: 10},
+		{header: "bytes=10-", size: 10, err: httprange.ErrUnsatisfiable},
+		{header: "bytes=4-2", size: 10, err: httprange.ErrUnsatisfiable},
+		{header: "bytes=-0", size: 10, err: httprange.ErrUnsatisfiable},
+		{header: "bytes=a-b", size: 10, err: httprange.ErrUnsatisfiable},
+		{header: "bytes=0-", size: 0, err: httprange.ErrUnsatisfiable},
+		{header: "bytes=-5", size: 0, err: httprange.ErrUnsatisfiable},
+	}
+	for _, tt := range tests {
+		start, length, ok, err := httprange.Parse(tt.header, tt.size)
+		assert.Equal(t, tt.err, err, tt.header)
+		assert.Equal(t, tt.ok, ok, tt.header)
+		assert.Equal(t, tt.start, start, tt.header)
+		assert.Equal(t, tt.length, length, tt.header)
+	}
+}
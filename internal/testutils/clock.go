@@ -0,0 +1,145 @@
+package testutils
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shopify/go-storage"
+)
+
+// NewFakeClock creates a storage.Clock whose time starts at now, and only moves with Advance.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+
+	return c
+}
+
+// FakeClock is a storage.Clock for tests, see NewFakeClock.
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// Now implements storage.Clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer implements storage.Clock.
+func (c *FakeClock) NewTimer(d time.Duration) storage.Timer {
+	return c.newTimer(d, make(chan time.Time, 1), nil)
+}
+
+// AfterFunc implements storage.Clock.  f is called by Advance.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) storage.Timer {
+	return c.newTimer(d, nil, f)
+}
+
+func (c *FakeClock) newTimer(d time.Duration, ch chan time.Time, f func()) *fakeTimer {
+	t := &fakeTimer{clock: c, c: ch, f: f}
+	t.Reset(d)
+
+	return t
+}
+
+// Advance moves the time forward by d, firing the timers expiring until then, in order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	var fired, active []*fakeTimer
+	for _, t := range c.timers {
+		if t.when.After(now) {
+			active = append(active, t)
+		} else {
+			fired = append(fired, t)
+		}
+	}
+	c.timers = active
+	c.mu.Unlock()
+
+	sort.SliceStable(fired, func(i, j int) bool { return fired[i].when.Before(fired[j].when) })
+	for _, t := range fired {
+		t.fire(now)
+	}
+}
+
+// WaitForTimers blocks until at least n timers are active, e.g. until the code under test started waiting.
+func (c *FakeClock) WaitForTimers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	c     chan time.Time
+	f     func()
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reset implements storage.Timer.  Like time.Timer, the timer fires immediately if d <= 0.
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	active := t.Stop()
+
+	c := t.clock
+	c.mu.Lock()
+	now := c.now
+	t.when = now.Add(d)
+	expired := !t.when.After(now)
+	if !expired {
+		c.timers = append(c.timers, t)
+		c.cond.Broadcast()
+	}
+	c.mu.Unlock()
+
+	if expired {
+		t.fire(now)
+	}
+
+	return active
+}
+
+// fire sends now on the channel of the timer, or calls its func.
+func (t *fakeTimer) fire(now time.Time) {
+	if t.f != nil {
+		t.f()
+
+		return
+	}
+
+	select {
+	case t.c <- now:
+	default:
+	}
+}
@@ -29,6 +29,11 @@ func OpenExists(t *testing.T, fs storage.FS, path string, content string) {
 	assert.Equal(t, f.Attributes.Size, attrs.Size)
 	assert.Equal(t, f.Attributes.ContentType, attrs.ContentType)
 	assert.Equal(t, f.Attributes.ContentEncoding, attrs.ContentEncoding)
+	if f.Attributes.MD5 != nil {
+		// Not all FS return the MD5 when opening a file
+		assert.Equal(t, f.Attributes.MD5, attrs.MD5)
+	}
+	assert.Equal(t, f.Attributes.CRC32C, attrs.CRC32C)
 
 	err = f.Close()
 	assert.NoError(t, err)
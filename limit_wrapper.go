@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// LimitOptions are used to configure NewLimitWrapper.
+type LimitOptions struct {
+	// Limits is the maximum total weight of in-flight operations, per Op.
+	// Operations without a limit, or with a limit <= 0, are not limited.
+	Limits map[Op]int64
+
+	// Weights is the weight of a single operation, per Op.  Defaults to 1.
+	// An operation heavier than its limit will wait until its context is done.
+	Weights map[Op]int64
+}
+
+// NewLimitWrapper creates an FS which caps the number of in-flight operations per Op, so bulk jobs
+// cannot starve other users of the same FS.
+//
+// Open and Create hold their slot until the returned File or writer is closed, and Walk holds it
+// until the walk is complete.  Operations waiting for a slot return early if their context is done.
+func NewLimitWrapper(fs FS, options *LimitOptions) *LimitWrapper {
+	if options == nil {
+		options = &LimitOptions{}
+	}
+
+	l := &LimitWrapper{
+		fs:      fs,
+		weights: options.Weights,
+		sems:    make(map[Op]*semaphore.Weighted, len(options.Limits)),
+		queued:  make(map[Op]*int64, len(options.Limits)),
+	}
+	for op, limit := range options.Limits {
+		if limit <= 0 {
+			continue
+		}
+		l.sems[op] = semaphore.NewWeighted(limit)
+		l.queued[op] = new(int64)
+	}
+
+	return l
+}
+
+// LimitWrapper is an FS which limits the concurrency of operations.
+type LimitWrapper struct {
+	fs      FS
+	weights map[Op]int64
+
+	sems   map[Op]*semaphore.Weighted
+	queued map[Op]*int64
+}
+
+// QueueDepth returns the number of operations waiting for a slot for op.
+func (l *LimitWrapper) QueueDepth(op Op) int64 {
+	if q, ok := l.queued[op]; ok {
+		return atomic.LoadInt64(q)
+	}
+
+	return 0
+}
+
+// acquire waits for a slot for op, and returns the func releasing it.
+func (l *LimitWrapper) acquire(ctx context.Context, op Op) (func(), error) {
+	sem, ok := l.sems[op]
+	if !ok {
+		return func() {}, nil
+	}
+
+	weight := int64(1)
+	if w, ok := l.weights[op]; ok {
+		weight = w
+	}
+
+	atomic.AddInt64(l.queued[op], 1)
+	err := sem.Acquire(ctx, weight)
+	atomic.AddInt64(l.queued[op], -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() { sem.Release(weight) })
+	}, nil
+}
+
+// limitReadCloser releases its slot when closed.
+type limitReadCloser struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *limitReadCloser) Close() error {
+	defer r.release()
+
+	return r.ReadCloser.Close()
+}
+
+// limitWriteCloser releases its slot when closed.
+type limitWriteCloser struct {
+	io.WriteCloser
+	release func()
+}
+
+func (w *limitWriteCloser) Close() error {
+	defer w.release()
+
+	return w.WriteCloser.Close()
+}
+
+// Open implements FS.  The slot is held until the File is closed.
+func (l *LimitWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	release, err := l.acquire(ctx, OpOpen)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := l.fs.Open(ctx, path, options)
+	if err != nil {
+		release()
+
+		return nil, err
+	}
+	f.ReadCloser = &limitReadCloser{
+		ReadCloser: f.ReadCloser,
+		release:    release,
+	}
+
+	return f, nil
+}
+
+// Attributes implements FS.
+func (l *LimitWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	release, err := l.acquire(ctx, OpAttributes)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return l.fs.Attributes(ctx, path, options)
+}
+
+// Create implements FS.  The slot is held until the writer is closed.
+func (l *LimitWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	release, err := l.acquire(ctx, OpCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := l.fs.Create(ctx, path, options)
+	if err != nil {
+		release()
+
+		return nil, err
+	}
+
+	return &limitWriteCloser{
+		WriteCloser: w,
+		release:     release,
+	}, nil
+}
+
+// Delete implements FS.
+func (l *LimitWrapper) Delete(ctx context.Context, path string) error {
+	release, err := l.acquire(ctx, OpDelete)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return l.fs.Delete(ctx, path)
+}
+
+// Walk implements FS.  The slot is held for the whole walk.
+func (l *LimitWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	release, err := l.acquire(ctx, OpWalk)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return l.fs.Walk(ctx, path, fn)
+}
+
+func (l *LimitWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	release, err := l.acquire(ctx, OpURL)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	return l.fs.URL(ctx, path, options)
+}
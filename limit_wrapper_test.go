@@ -0,0 +1,70 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func TestLimitWrapper(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		fs := storage.NewLimitWrapper(mem, &storage.LimitOptions{
+			Limits: map[storage.Op]int64{
+				storage.OpOpen:   1,
+				storage.OpCreate: 1,
+			},
+		})
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+	})
+}
+
+func TestLimitWrapper_zeroLimit(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		// A limit of 0 doesn't block forever, the operation is not limited
+		fs := storage.NewLimitWrapper(mem, &storage.LimitOptions{
+			Limits: map[storage.Op]int64{storage.OpOpen: 0, storage.OpCreate: -1},
+		})
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.OpenExists(t, fs, "foo", "bar")
+	})
+}
+
+func TestLimitWrapper_Open_holdsSlot(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		testutils.Create(t, mem, "foo", "bar")
+		fs := storage.NewLimitWrapper(mem, &storage.LimitOptions{
+			Limits: map[storage.Op]int64{storage.OpOpen: 1},
+		})
+
+		f, err := fs.Open(ctx, "foo", nil)
+		require.NoError(t, err)
+
+		// The slot is held by f, so a second Open is queued until its context is done
+		timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		queued := make(chan error)
+		go func() {
+			_, err := fs.Open(timeoutCtx, "foo", nil)
+			queued <- err
+		}()
+
+		assert.Eventually(t, func() bool { return fs.QueueDepth(storage.OpOpen) == 1 }, time.Second, time.Millisecond)
+		assert.ErrorIs(t, <-queued, context.DeadlineExceeded)
+		assert.Equal(t, int64(0), fs.QueueDepth(storage.OpOpen))
+
+		// Closing the File releases the slot
+		require.NoError(t, f.Close())
+		f, err = fs.Open(ctx, "foo", nil)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	})
+}
@@ -2,11 +2,14 @@ package storage
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // DefaultLocalCreatePathMode is the default os.FileMode used when creating directories
@@ -17,16 +20,39 @@ const DefaultLocalCreatePathMode = os.FileMode(0o755)
 var LocalCreatePathMode = DefaultLocalCreatePathMode
 
 // localFS is a local FS and Walker implementation.
-type localFS string
+type localFS struct {
+	root   string
+	signer *URLSigner
+}
 
 func NewLocalFS(path string) FS {
-	fs := localFS(path)
+	return NewLocalFSWithOptions(path, nil)
+}
+
+// LocalFSOptions are used to configure NewLocalFSWithOptions.
+type LocalFSOptions struct {
+	// URLSigner signs the URLs returned by URL, to be served by NewURLHandler.  By default, URL returns
+	// file:// URLs.
+	URLSigner *URLSigner
+}
+
+// NewLocalFSWithOptions creates an FS storing files under path, configured by options.
+//
+// The checksums of WriterOptions are verified by Create, but they are not stored: Open and Attributes
+// don't return any.
+func NewLocalFSWithOptions(path string, options *LocalFSOptions) FS {
+	if options == nil {
+		options = &LocalFSOptions{}
+	}
 
-	return &fs
+	return &localFS{
+		root:   path,
+		signer: options.URLSigner,
+	}
 }
 
 func (l *localFS) fullPath(path string) string {
-	return filepath.Join(string(*l), path)
+	return filepath.Join(l.root, path)
 }
 
 func (l *localFS) wrapError(path string, err error) error {
@@ -39,7 +65,7 @@ func (l *localFS) wrapError(path string, err error) error {
 	return err
 }
 
-// Open implements FS.
+// Open implements FS.  There is nowhere to store the checksums, so the Attributes have none.
 func (l *localFS) Open(_ context.Context, path string, _ *ReaderOptions) (*File, error) {
 	path = l.fullPath(path)
 
@@ -50,6 +76,8 @@ func (l *localFS) Open(_ context.Context, path string, _ *ReaderOptions) (*File,
 
 	stat, err := f.Stat()
 	if err != nil {
+		_ = f.Close()
+
 		return nil, l.wrapError(path, err)
 	}
 
@@ -62,7 +90,7 @@ func (l *localFS) Open(_ context.Context, path string, _ *ReaderOptions) (*File,
 	}, nil
 }
 
-// Attributes implements FS.
+// Attributes implements FS.  Like Open, the Attributes have no checksums.
 func (l *localFS) Attributes(_ context.Context, path string, _ *ReaderOptions) (*Attributes, error) {
 	path = l.fullPath(path)
 
@@ -77,9 +105,83 @@ func (l *localFS) Attributes(_ context.Context, path string, _ *ReaderOptions) (
 	}, nil
 }
 
+// localTempPrefix is the prefix of the names of the temporary files written by Create.  They are
+// skipped by Walk.
+const localTempPrefix = ".storage-tmp-"
+
+// localWriter writes to a temporary file in the directory of the path, which is renamed to the path
+// on Close, so the file is only written once complete.
+// The *os.File isn't embedded so io.Copy can't bypass Write with os.File.ReadFrom.
+type localWriter struct {
+	ctx        context.Context
+	f          *os.File
+	path       string
+	ifNotExist bool
+	modTime    time.Time
+	expected   Attributes
+	c          *checksummer
+}
+
+func (w *localWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.c.Write(p[:n])
+
+	return n, err
+}
+
+// Close implements io.Closer.  The file is not written if the context of Create is done, or if its
+// content doesn't match the checksums of the options.
+func (w *localWriter) Close() error {
+	tmp := w.f.Name()
+	err := w.f.Close()
+	if err == nil {
+		err = w.ctx.Err()
+	}
+	if err == nil {
+		err = w.c.verify(w.path, &w.expected)
+	}
+	if err == nil && !w.modTime.IsZero() {
+		err = os.Chtimes(tmp, w.modTime, w.modTime)
+	}
+	if err == nil {
+		err = w.commit(tmp)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+
+		return err
+	}
+
+	return nil
+}
+
+// commit moves the temporary file tmp to the path.
+func (w *localWriter) commit(tmp string) error {
+	if !w.ifNotExist {
+		return os.Rename(tmp, w.path)
+	}
+
+	// Unlike Rename, Link fails if the path exists
+	if err := os.Link(tmp, w.path); err != nil {
+		if os.IsExist(err) {
+			return &existError{
+				Path: w.path,
+			}
+		}
+
+		return err
+	}
+	_ = os.Remove(tmp)
+
+	return nil
+}
+
 // Create implements FS.  If the path contains any directories which do not already exist
 // then Create will try to make them, returning an error if it fails.
-func (l *localFS) Create(_ context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+func (l *localFS) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	if options == nil {
+		options = &WriterOptions{}
+	}
 	path = l.fullPath(path)
 
 	dir := filepath.Dir(path)
@@ -89,24 +191,41 @@ func (l *localFS) Create(_ context.Context, path string, options *WriterOptions)
 		}
 	}
 
-	f, err := os.Create(path)
+	if options.IfNotExist {
+		// Fail early, the check is atomic on Close
+		if _, err := os.Lstat(path); err == nil {
+			return nil, &existError{
+				Path: path,
+			}
+		}
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(dir, localTempPrefix+hex.EncodeToString(suffix))
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666) //nolint:gosec // Same permissions as os.Create.
 	if err != nil {
 		return nil, err
 	}
-	if options != nil {
-		if !options.Attributes.CreationTime.IsZero() {
-			// There is no way to store the CreationTime, so overwrite the ModTime
-			// This is necessary so the CacheWrapper can use LocalFS
-			options.Attributes.ModTime = options.Attributes.CreationTime
-		}
-		if !options.Attributes.ModTime.IsZero() {
-			if err := os.Chtimes(path, options.Attributes.ModTime, options.Attributes.ModTime); err != nil {
-				return f, err
-			}
-		}
+
+	// There is no way to store the CreationTime, so it overwrites the ModTime
+	// This is necessary so the CacheWrapper can use LocalFS
+	modTime := options.Attributes.ModTime
+	if !options.Attributes.CreationTime.IsZero() {
+		modTime = options.Attributes.CreationTime
 	}
 
-	return f, nil
+	return &localWriter{
+		ctx:        ctx,
+		f:          f,
+		path:       path,
+		ifNotExist: options.IfNotExist,
+		modTime:    modTime,
+		expected:   options.Attributes,
+		c:          newChecksummer(),
+	}, nil
 }
 
 // Delete implements FS.  All files underneath path will be removed.
@@ -121,8 +240,8 @@ func (l *localFS) Walk(_ context.Context, path string, fn WalkFn) error {
 			return err
 		}
 
-		if !f.IsDir() {
-			path = strings.TrimPrefix(path, string(*l))
+		if !f.IsDir() && !strings.HasPrefix(f.Name(), localTempPrefix) {
+			path = strings.TrimPrefix(path, l.root)
 
 			return fn(path)
 		}
@@ -131,7 +250,11 @@ func (l *localFS) Walk(_ context.Context, path string, fn WalkFn) error {
 	})
 }
 
-func (l *localFS) URL(_ context.Context, path string, _ *SignedURLOptions) (string, error) {
+func (l *localFS) URL(_ context.Context, path string, options *SignedURLOptions) (string, error) {
+	if l.signer != nil {
+		return l.signer.SignURL(path, options)
+	}
+
 	path = l.fullPath(path)
 	_, err := os.Stat(path)
 	if err != nil {
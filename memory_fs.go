@@ -6,13 +6,32 @@ import (
 	"io"
 	"strings"
 	"sync"
-	"time"
 )
 
 // NewMemoryFS creates a a basic in-memory implementation of FS.
 func NewMemoryFS() FS {
+	return NewMemoryFSWithOptions(nil)
+}
+
+// MemoryFSOptions are used to configure NewMemoryFSWithOptions.
+type MemoryFSOptions struct {
+	// Clock stamps the ModTime of files.  Defaults to the system clock.
+	Clock Clock
+	// URLSigner signs the URLs returned by URL, to be served by NewURLHandler.  By default, URL returns
+	// ErrNotImplemented.
+	URLSigner *URLSigner
+}
+
+// NewMemoryFSWithOptions creates a new in-memory FS configured by options.
+func NewMemoryFSWithOptions(options *MemoryFSOptions) FS {
+	if options == nil {
+		options = &MemoryFSOptions{}
+	}
+
 	return &memoryFS{
-		data: make(map[string]*memFile),
+		data:   make(map[string]*memFile),
+		clock:  clockOrDefault(options.Clock),
+		signer: options.URLSigner,
 	}
 }
 
@@ -28,7 +47,9 @@ func (f *memFile) readCloser() io.ReadCloser {
 type memoryFS struct {
 	sync.RWMutex
 
-	data map[string]*memFile
+	data   map[string]*memFile
+	clock  Clock
+	signer *URLSigner
 }
 
 // Open implements FS.
@@ -39,7 +60,7 @@ func (m *memoryFS) Open(_ context.Context, path string, _ *ReaderOptions) (*File
 
 	if ok {
 		return &File{
-			ReadCloser: f.readCloser(),
+			ReadCloser: verifyChecksums(path, f.attrs, f.readCloser()),
 			Attributes: f.attrs,
 		}, nil
 	}
@@ -68,25 +89,48 @@ func (m *memoryFS) Attributes(_ context.Context, path string, _ *ReaderOptions)
 
 type writingFile struct {
 	*bytes.Buffer
+	ctx  context.Context
 	path string
 
 	m       *memoryFS
 	options *WriterOptions
 }
 
+// Close implements io.Closer.  The file is not written if the context of Create is done, or if its
+// content doesn't match the checksums of the options.
 func (wf *writingFile) Close() error {
+	if err := wf.ctx.Err(); err != nil {
+		return err
+	}
+
 	if wf.options.Attributes.Size == 0 {
 		wf.options.Attributes.Size = int64(wf.Buffer.Len())
 	}
 
+	c := newChecksummer()
+	c.Write(wf.Buffer.Bytes())
+	if err := c.verify(wf.path, &wf.options.Attributes); err != nil {
+		return err
+	}
+	// The checksums are not set on the options, as they may be reused for other files.
+	attrs := wf.options.Attributes
+	c.setChecksums(&attrs)
+
 	wf.m.Lock()
+	if _, ok := wf.m.data[wf.path]; ok && wf.options.IfNotExist {
+		wf.m.Unlock()
+
+		return &existError{
+			Path: wf.path,
+		}
+	}
 	// Record time with the lock so the time is accurate
-	if wf.options.Attributes.ModTime.IsZero() {
-		wf.options.Attributes.ModTime = time.Now()
+	if attrs.ModTime.IsZero() {
+		attrs.ModTime = wf.m.clock.Now()
 	}
 	wf.m.data[wf.path] = &memFile{
 		data:  wf.Buffer.Bytes(),
-		attrs: wf.options.Attributes,
+		attrs: attrs,
 	}
 	wf.m.Unlock()
 
@@ -94,19 +138,47 @@ func (wf *writingFile) Close() error {
 }
 
 // Create implements FS.  NB: Callers must close the io.WriteCloser to create the file.
-func (m *memoryFS) Create(_ context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+func (m *memoryFS) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
 	if options == nil {
 		options = &WriterOptions{}
 	}
 
 	return &writingFile{
 		Buffer:  &bytes.Buffer{},
+		ctx:     ctx,
 		path:    path,
 		m:       m,
 		options: options,
 	}, nil
 }
 
+// updateMetadata implements metadataUpdater.
+func (m *memoryFS) updateMetadata(_ context.Context, path string, edit func(map[string]string)) error {
+	m.Lock()
+	defer m.Unlock()
+
+	f, ok := m.data[path]
+	if !ok {
+		return &notExistError{
+			Path: path,
+		}
+	}
+
+	metadata := make(map[string]string, len(f.attrs.Metadata))
+	for k, v := range f.attrs.Metadata {
+		metadata[k] = v
+	}
+	edit(metadata)
+	attrs := f.attrs
+	attrs.Metadata = metadata
+	m.data[path] = &memFile{
+		data:  f.data,
+		attrs: attrs,
+	}
+
+	return nil
+}
+
 // Delete implements FS.
 func (m *memoryFS) Delete(_ context.Context, path string) error {
 	m.Lock()
@@ -136,6 +208,10 @@ func (m *memoryFS) Walk(_ context.Context, path string, fn WalkFn) error {
 	return nil
 }
 
-func (m *memoryFS) URL(_ context.Context, _ string, _ *SignedURLOptions) (string, error) {
-	return "", ErrNotImplemented
+func (m *memoryFS) URL(_ context.Context, path string, options *SignedURLOptions) (string, error) {
+	if m.signer == nil {
+		return "", ErrNotImplemented
+	}
+
+	return m.signer.SignURL(path, options)
 }
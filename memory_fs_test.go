@@ -1,7 +1,12 @@
 package storage_test
 
 import (
+	"context"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/Shopify/go-storage"
 	"github.com/Shopify/go-storage/internal/testutils"
@@ -29,3 +34,20 @@ func TestMemDelete(t *testing.T) {
 		testutils.Delete(t, fs, "foo")
 	})
 }
+
+func TestMemModTime(t *testing.T) {
+	clock := testutils.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	fs := storage.NewMemoryFSWithOptions(&storage.MemoryFSOptions{Clock: clock})
+
+	testutils.Create(t, fs, "foo", "bar")
+	clock.Advance(time.Hour)
+	testutils.Create(t, fs, "bar", "baz")
+
+	ctx := context.Background()
+	attrs, err := fs.Attributes(ctx, "foo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), attrs.ModTime)
+	attrs, err = fs.Attributes(ctx, "bar", nil)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 1, 1, 1, 0, 0, 0, time.UTC), attrs.ModTime)
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// metadataUpdater is implemented by the FS which can update the metadata of a file without rewriting it.
+type metadataUpdater interface {
+	// updateMetadata calls edit with a copy of the metadata of path, and replaces the metadata with it.
+	updateMetadata(ctx context.Context, path string, edit func(map[string]string)) error
+}
+
+// updateMetadata edits the metadata of path with edit.
+//
+// It is updated in place if fs implements metadataUpdater.  Otherwise, the file is copied to a temporary
+// path next to path with the new metadata, then back over path, so a complete copy always exists: the
+// temporary copy is kept if overwriting path fails.
+func updateMetadata(ctx context.Context, fs FS, path string, edit func(map[string]string)) error {
+	if u, ok := fs.(metadataUpdater); ok {
+		return u.updateMetadata(ctx, path, edit)
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	tmp := path + ".tmp-" + hex.EncodeToString(suffix)
+	if err := copyFile(ctx, fs, path, tmp, edit); err != nil {
+		_ = fs.Delete(ctx, tmp)
+
+		return err
+	}
+	if err := copyFile(ctx, fs, tmp, path, nil); err != nil {
+		return fmt.Errorf("storage %s: updated copy kept at %s: %w", path, tmp, err)
+	}
+
+	return fs.Delete(ctx, tmp)
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/Shopify/go-storage"
+
+// NewMetricsWrapper creates an FS which records metrics of the calls to fs with the meters of mp.  There is
+// no global state: each wrapper records with the MeterProvider it is given, which can export to any metrics
+// system supported by OpenTelemetry (e.g. Prometheus).
+//
+// The metrics have an "fs" attribute set to name:
+//   - storage.operation.duration: histogram of the duration of operations in seconds, with the "op" and
+//     "error_class" attributes.  The duration of Open and Create is the one of the call.
+//   - storage.operation.in_flight: number of operations in progress, with the "op" attribute.
+//   - storage.transfer.duration: histogram of the duration of Open and Create in seconds until the File or
+//     writer is closed, with the "op" and "error_class" (of Close) attributes.
+//   - storage.read.bytes and storage.write.bytes: bytes read from Files returned by Open, and written to
+//     writers returned by Create.
+//   - storage.walk.entries: number of paths walked.
+func NewMetricsWrapper(fs FS, name string, mp metric.MeterProvider) (FS, error) {
+	meter := mp.Meter(meterName)
+	m := &metricsWrapper{
+		fs:    fs,
+		attrs: attribute.NewSet(attribute.String("fs", name)),
+	}
+
+	var err error
+	if m.duration, err = meter.Float64Histogram("storage.operation.duration",
+		metric.WithDescription("Duration of storage operations."), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if m.transferDuration, err = meter.Float64Histogram("storage.transfer.duration",
+		metric.WithDescription("Duration of storage transfers, until the file or writer is closed."), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if m.inFlight, err = meter.Int64UpDownCounter("storage.operation.in_flight",
+		metric.WithDescription("Number of storage operations in progress."), metric.WithUnit("{operation}")); err != nil {
+		return nil, err
+	}
+	if m.readBytes, err = meter.Int64Counter("storage.read.bytes",
+		metric.WithDescription("Bytes read from storage."), metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	if m.writeBytes, err = meter.Int64Counter("storage.write.bytes",
+		metric.WithDescription("Bytes written to storage."), metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	if m.walkEntries, err = meter.Int64Counter("storage.walk.entries",
+		metric.WithDescription("Number of paths walked."), metric.WithUnit("{path}")); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+type metricsWrapper struct {
+	fs    FS
+	attrs attribute.Set
+
+	duration         metric.Float64Histogram
+	transferDuration metric.Float64Histogram
+	inFlight         metric.Int64UpDownCounter
+	readBytes        metric.Int64Counter
+	writeBytes       metric.Int64Counter
+	walkEntries      metric.Int64Counter
+}
+
+func (m *metricsWrapper) opAttrs(op Op) metric.MeasurementOption {
+	return metric.WithAttributes(append(m.attrs.ToSlice(), attribute.String("op", string(op)))...)
+}
+
+// start records the start of op, and returns the func recording its end.
+func (m *metricsWrapper) start(ctx context.Context, op Op) func(err error) {
+	start := time.Now()
+	opAttrs := m.opAttrs(op)
+	m.inFlight.Add(ctx, 1, opAttrs)
+
+	return func(err error) {
+		m.inFlight.Add(ctx, -1, opAttrs)
+		m.duration.Record(ctx, time.Since(start).Seconds(), opAttrs,
+			metric.WithAttributes(attribute.String("error_class", errorClass(err))))
+	}
+}
+
+// transferred records the duration of the transfer of op, started at start, when closing with err.
+func (m *metricsWrapper) transferred(ctx context.Context, op Op, start time.Time, err error) {
+	m.transferDuration.Record(ctx, time.Since(start).Seconds(), m.opAttrs(op),
+		metric.WithAttributes(attribute.String("error_class", errorClass(err))))
+}
+
+// Open implements FS.
+func (m *metricsWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	start := time.Now()
+	done := m.start(ctx, OpOpen)
+	f, err := m.fs.Open(ctx, path, options)
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+
+	f.ReadCloser = &countingReadCloser{
+		ReadCloser: f.ReadCloser,
+		close: func(n int64, err error) error {
+			m.readBytes.Add(ctx, n, metric.WithAttributeSet(m.attrs))
+			m.transferred(ctx, OpOpen, start, err)
+
+			return err
+		},
+	}
+
+	return f, nil
+}
+
+// Attributes implements FS.
+func (m *metricsWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	done := m.start(ctx, OpAttributes)
+	attrs, err := m.fs.Attributes(ctx, path, options)
+	done(err)
+
+	return attrs, err
+}
+
+// Create implements FS.
+func (m *metricsWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	start := time.Now()
+	done := m.start(ctx, OpCreate)
+	wc, err := m.fs.Create(ctx, path, options)
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingWriteCloser{
+		WriteCloser: wc,
+		close: func(n int64, err error) error {
+			m.writeBytes.Add(ctx, n, metric.WithAttributeSet(m.attrs))
+			m.transferred(ctx, OpCreate, start, err)
+
+			return err
+		},
+	}, nil
+}
+
+// Delete implements FS.
+func (m *metricsWrapper) Delete(ctx context.Context, path string) error {
+	done := m.start(ctx, OpDelete)
+	err := m.fs.Delete(ctx, path)
+	done(err)
+
+	return err
+}
+
+// Walk implements FS.
+func (m *metricsWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	done := m.start(ctx, OpWalk)
+	err := m.fs.Walk(ctx, path, func(path string) error {
+		m.walkEntries.Add(ctx, 1, metric.WithAttributeSet(m.attrs))
+
+		return fn(path)
+	})
+	done(err)
+
+	return err
+}
+
+// URL implements FS.
+func (m *metricsWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	done := m.start(ctx, OpURL)
+	url, err := m.fs.URL(ctx, path, options)
+	done(err)
+
+	return url, err
+}
@@ -0,0 +1,104 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func withMetrics(t *testing.T, cb func(fs storage.FS, reader *sdkmetric.ManualReader)) {
+	t.Helper()
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	withMem(func(mem storage.FS) {
+		fs, err := storage.NewMetricsWrapper(mem, "mem", mp)
+		require.NoError(t, err)
+		cb(fs, reader)
+	})
+}
+
+func collectMetrics(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Aggregation {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+
+	return metrics
+}
+
+func TestMetricsWrapper(t *testing.T) {
+	withMetrics(t, func(fs storage.FS, _ *sdkmetric.ManualReader) {
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+	})
+}
+
+func TestMetricsWrapper_metrics(t *testing.T) {
+	ctx := context.Background()
+
+	withMetrics(t, func(fs storage.FS, reader *sdkmetric.ManualReader) {
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), nil))
+
+		f, err := fs.Open(ctx, "foo", nil)
+		require.NoError(t, err)
+		// The operation is over once Open returns, even if the File isn't closed yet
+		metrics := collectMetrics(t, reader)
+		inFlight := metrics["storage.operation.in_flight"].(metricdata.Sum[int64])
+		for _, dp := range inFlight.DataPoints {
+			assert.Equal(t, int64(0), dp.Value)
+		}
+		for _, dp := range metrics["storage.transfer.duration"].(metricdata.Histogram[float64]).DataPoints {
+			op, _ := dp.Attributes.Value("op")
+			assert.NotEqual(t, "open", op.AsString(), "the transfer is not over")
+		}
+		buf := make([]byte, 8)
+		_, _ = f.Read(buf)
+		require.NoError(t, f.Close())
+
+		_, err = fs.Open(ctx, "missing", nil)
+		require.Error(t, err)
+		_, err = storage.List(ctx, fs, "")
+		require.NoError(t, err)
+
+		metrics = collectMetrics(t, reader)
+		assert.Equal(t, int64(3), metrics["storage.read.bytes"].(metricdata.Sum[int64]).DataPoints[0].Value)
+		assert.Equal(t, int64(3), metrics["storage.write.bytes"].(metricdata.Sum[int64]).DataPoints[0].Value)
+		assert.Equal(t, int64(1), metrics["storage.walk.entries"].(metricdata.Sum[int64]).DataPoints[0].Value)
+
+		counts := make(map[attribute.Distinct]uint64)
+		var notExist uint64
+		for _, dp := range metrics["storage.operation.duration"].(metricdata.Histogram[float64]).DataPoints {
+			name, _ := dp.Attributes.Value("fs")
+			assert.Equal(t, "mem", name.AsString())
+			counts[dp.Attributes.Equivalent()] += dp.Count
+			if class, _ := dp.Attributes.Value("error_class"); class.AsString() == "not_exist" {
+				notExist += dp.Count
+			}
+		}
+		assert.Len(t, counts, 4, "create, open, failed open and walk")
+		assert.Equal(t, uint64(1), notExist)
+
+		var transfers uint64
+		for _, dp := range metrics["storage.transfer.duration"].(metricdata.Histogram[float64]).DataPoints {
+			transfers += dp.Count
+		}
+		assert.Equal(t, uint64(2), transfers, "create and open")
+	})
+}
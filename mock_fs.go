@@ -1,8 +1,11 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"os"
+	"sync"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -30,6 +33,9 @@ func (m *MockFS) Open(ctx context.Context, path string, options *ReaderOptions)
 	if file == nil {
 		return nil, err
 	}
+	if newFile, ok := file.(func() *File); ok {
+		return newFile(), err
+	}
 
 	return file.(*File), err
 }
@@ -52,6 +58,9 @@ func (m *MockFS) Create(ctx context.Context, path string, options *WriterOptions
 	if w == nil {
 		return nil, err
 	}
+	if newWriter, ok := w.(func() io.WriteCloser); ok {
+		return newWriter(), err
+	}
 
 	return w.(io.WriteCloser), err
 }
@@ -69,3 +78,56 @@ func (m *MockFS) URL(ctx context.Context, path string, options *SignedURLOptions
 
 	return url, err
 }
+
+// OnOpenReturning mocks Open of path, whatever the context and options, to return a new File with content
+// and attrs on each call.  The Size of attrs defaults to the length of content.
+func (m *MockFS) OnOpenReturning(path string, content []byte, attrs Attributes) *mock.Call {
+	if attrs.Size == 0 {
+		attrs.Size = int64(len(content))
+	}
+
+	return m.On("Open", mock.Anything, path, mock.Anything).Return(func() *File {
+		return &File{
+			ReadCloser: io.NopCloser(bytes.NewReader(content)),
+			Attributes: attrs,
+		}
+	}, nil)
+}
+
+// OnCreateCapturing mocks Create of path, whatever the context and options, to return a new writer on each
+// call, appending to the returned buffer until it is closed.  The buffer must not be read while writers are
+// in use.
+func (m *MockFS) OnCreateCapturing(path string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	mu := &sync.Mutex{}
+	m.On("Create", mock.Anything, path, mock.Anything).Return(func() io.WriteCloser {
+		return &captureWriter{mu: mu, buf: buf}
+	}, nil)
+
+	return buf
+}
+
+// captureWriter writes to buf, shared by the writers of OnCreateCapturing along with mu.
+type captureWriter struct {
+	mu     *sync.Mutex
+	buf    *bytes.Buffer
+	closed bool
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	return w.buf.Write(p)
+}
+
+func (w *captureWriter) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+
+	return nil
+}
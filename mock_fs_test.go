@@ -2,11 +2,13 @@ package storage_test
 
 import (
 	"context"
+	"io"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/Shopify/go-storage"
 )
@@ -89,3 +91,45 @@ func Test_mockFS_Walk(t *testing.T) {
 	assert.NoError(t, err)
 	fs.AssertExpectations(t)
 }
+
+func Test_mockFS_OnOpenReturning(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewMockFS()
+	fs.OnOpenReturning("foo", []byte("bar"), storage.Attributes{ContentType: "text/plain"})
+
+	for i := 0; i < 2; i++ {
+		f, err := fs.Open(ctx, "foo", nil)
+		require.NoError(t, err)
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(data))
+		assert.Equal(t, "text/plain", f.ContentType)
+		assert.Equal(t, int64(3), f.Size)
+	}
+	fs.AssertExpectations(t)
+}
+
+func Test_mockFS_OnCreateCapturing(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewMockFS()
+	buf := fs.OnCreateCapturing("foo")
+
+	err := storage.Write(ctx, fs, "foo", []byte("bar"), &storage.WriterOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "bar", buf.String())
+
+	// Each Create returns a new writer, which can't be written once closed
+	w1, err := fs.Create(ctx, "foo", nil)
+	require.NoError(t, err)
+	w2, err := fs.Create(ctx, "foo", nil)
+	require.NoError(t, err)
+	assert.NotSame(t, w1, w2)
+	require.NoError(t, w1.Close())
+	_, err = w1.Write([]byte("baz"))
+	require.Error(t, err)
+	_, err = w2.Write([]byte("baz"))
+	require.NoError(t, err)
+	require.NoError(t, w2.Close())
+	assert.Equal(t, "barbaz", buf.String())
+	fs.AssertExpectations(t)
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying identity, the caller of the operations using ctx.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity set with WithIdentity, or "" if none is set.
+func IdentityFromContext(ctx context.Context) string {
+	identity, _ := ctx.Value(identityKey{}).(string)
+
+	return identity
+}
+
+// PolicyEffect is the effect of a PolicyRule.
+type PolicyEffect string
+
+const (
+	PolicyAllow PolicyEffect = "allow"
+	PolicyDeny  PolicyEffect = "deny"
+)
+
+// PolicyRule allows or denies scopes on paths to identities.
+type PolicyRule struct {
+	Effect PolicyEffect `json:"effect" yaml:"effect"`
+	// Identities are the identities the rule applies to.  If empty, or if it contains "*", it applies
+	// to all identities, including callers without identity.
+	Identities []string `json:"identities" yaml:"identities"`
+	// Paths are the glob patterns of the paths the rule applies to, see path.Match.  A "**" segment matches
+	// any number of path segments.  If empty, it applies to all paths.
+	Paths []string `json:"paths" yaml:"paths"`
+	// Scopes are the scopes allowed or denied by the rule, e.g. "read,write".
+	Scopes Scope `json:"scopes" yaml:"scopes"`
+}
+
+func (r *PolicyRule) matches(identity string, path string) bool {
+	return r.matchesIdentity(identity) && r.matchesPath(path)
+}
+
+func (r *PolicyRule) matchesIdentity(identity string) bool {
+	if len(r.Identities) == 0 {
+		return true
+	}
+	for _, id := range r.Identities {
+		if id == "*" || id == identity {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *PolicyRule) matchesPath(path string) bool {
+	if len(r.Paths) == 0 {
+		return true
+	}
+	for _, p := range r.Paths {
+		if matchGlob(p, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Policy is an ordered list of rules.  For each scope required by an operation, the first rule matching
+// the identity and path, and containing the scope, decides whether the scope is allowed.  Scopes matching no
+// rule are denied.
+type Policy struct {
+	Rules []PolicyRule `json:"rules" yaml:"rules"`
+}
+
+// LoadPolicy reads a Policy in YAML or JSON from r, e.g.
+//
+//	rules:
+//	  - effect: allow
+//	    identities: [service-a]
+//	    paths: ["reports/a/**"]
+//	    scopes: read,write
+//	  - effect: allow
+//	    paths: ["shared/**"]
+//	    scopes: read
+func LoadPolicy(r io.Reader) (*Policy, error) {
+	var p Policy
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("loading policy: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("loading policy: %w", err)
+	}
+
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	for i, r := range p.Rules {
+		if r.Effect != PolicyAllow && r.Effect != PolicyDeny {
+			return fmt.Errorf("rule %d: unknown effect: %q", i, r.Effect)
+		}
+		for _, path := range r.Paths {
+			if err := validateGlob(path); err != nil {
+				return fmt.Errorf("rule %d: path %q: %w", i, path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Allowed returns whether identity is granted scope on path.  Paths with "." or ".." segments are denied,
+// since some FS resolve them outside of the paths matched by the rules, e.g. localFS.
+func (p *Policy) Allowed(identity string, path string, scope Scope) bool {
+	path = strings.TrimPrefix(path, "/")
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	for s := Scope(1); s <= scope; s <<= 1 {
+		if scope.Has(s) && !p.allowed(identity, path, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *Policy) allowed(identity string, path string, scope Scope) bool {
+	for i := range p.Rules {
+		if r := &p.Rules[i]; r.Scopes.Has(scope) && r.matches(identity, path) {
+			return r.Effect == PolicyAllow
+		}
+	}
+
+	return false
+}
+
+// NewPolicyWrapper creates an FS which only allows the operations permitted by policy to the identity of
+// their context, set with WithIdentity.  Other operations fail with a *PermissionError.
+//
+// The scopes required by each operation are the ones of NewScopedWrapper.  Walk skips the paths which are
+// not readable.
+func NewPolicyWrapper(fs FS, policy *Policy) FS {
+	return &policyWrapper{
+		fs:     fs,
+		policy: policy,
+	}
+}
+
+type policyWrapper struct {
+	fs     FS
+	policy *Policy
+}
+
+func (p *policyWrapper) check(ctx context.Context, op Op, path string, options *SignedURLOptions) error {
+	required, err := opScope(op, path, options)
+	if err != nil {
+		return err
+	}
+	if !p.policy.Allowed(IdentityFromContext(ctx), path, required) {
+		return &PermissionError{Path: path, Op: op, Scope: required}
+	}
+
+	return nil
+}
+
+// Open implements FS.
+func (p *policyWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	if err := p.check(ctx, OpOpen, path, nil); err != nil {
+		return nil, err
+	}
+
+	return p.fs.Open(ctx, path, options)
+}
+
+// Attributes implements FS.
+func (p *policyWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	if err := p.check(ctx, OpAttributes, path, nil); err != nil {
+		return nil, err
+	}
+
+	return p.fs.Attributes(ctx, path, options)
+}
+
+// Create implements FS.
+func (p *policyWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	if err := p.check(ctx, OpCreate, path, nil); err != nil {
+		return nil, err
+	}
+
+	return p.fs.Create(ctx, path, options)
+}
+
+// Delete implements FS.
+func (p *policyWrapper) Delete(ctx context.Context, path string) error {
+	if err := p.check(ctx, OpDelete, path, nil); err != nil {
+		return err
+	}
+
+	return p.fs.Delete(ctx, path)
+}
+
+// Walk implements FS.  The paths which are not readable are skipped.
+func (p *policyWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	identity := IdentityFromContext(ctx)
+
+	return p.fs.Walk(ctx, path, func(path string) error {
+		if !p.policy.Allowed(identity, path, ScopeRead) {
+			return nil
+		}
+
+		return fn(path)
+	})
+}
+
+// URL implements FS.
+func (p *policyWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	if err := p.check(ctx, OpURL, path, options); err != nil {
+		return "", err
+	}
+
+	return p.fs.URL(ctx, path, options)
+}
@@ -0,0 +1,125 @@
+package storage_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+const testPolicy = `
+rules:
+  - effect: deny
+    paths: ["reports/a/secret/**"]
+    scopes: read,write,delete
+  - effect: allow
+    identities: [service-a]
+    paths: ["reports/a/**"]
+    scopes: read,write,delete
+  - effect: allow
+    paths: ["shared/**"]
+    scopes: read
+`
+
+func TestPolicyWrapper(t *testing.T) {
+	ctx := storage.WithIdentity(context.Background(), "service-a")
+
+	withMem(func(mem storage.FS) {
+		policy, err := storage.LoadPolicy(strings.NewReader(testPolicy))
+		require.NoError(t, err)
+		fs := storage.NewPolicyWrapper(mem, policy)
+
+		require.NoError(t, storage.Write(ctx, fs, "reports/a/foo", []byte("bar"), nil))
+		data, err := storage.Read(ctx, fs, "reports/a/foo", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(data))
+		require.NoError(t, fs.Delete(ctx, "reports/a/foo"))
+
+		err = storage.Write(ctx, fs, "reports/a/secret/foo", []byte("bar"), nil)
+		assert.ErrorIs(t, err, storage.ErrPermissionDenied)
+		err = storage.Write(ctx, fs, "shared/foo", []byte("bar"), nil)
+		assert.ErrorIs(t, err, storage.ErrPermissionDenied)
+
+		// Paths escaping the allowed ones are denied
+		for _, path := range []string{"reports/a/../../secret/foo", "reports/a/./secret/foo", "/reports/a/.."} {
+			_, err = fs.Attributes(ctx, path, nil)
+			assert.ErrorIs(t, err, storage.ErrPermissionDenied, path)
+		}
+
+		// Other identities can only read shared files
+		other := storage.WithIdentity(context.Background(), "service-b")
+		_, err = fs.Attributes(other, "reports/a/foo", nil)
+		assert.ErrorIs(t, err, storage.ErrPermissionDenied)
+	})
+}
+
+func TestPolicyWrapper_Walk(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		for _, path := range []string{"reports/a/foo", "reports/a/secret/foo", "reports/b/foo", "shared/foo"} {
+			testutils.Create(t, mem, path, "bar")
+		}
+
+		policy, err := storage.LoadPolicy(strings.NewReader(testPolicy))
+		require.NoError(t, err)
+		fs := storage.NewPolicyWrapper(mem, policy)
+
+		paths, err := storage.List(storage.WithIdentity(ctx, "service-a"), fs, "")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"reports/a/foo", "shared/foo"}, paths)
+
+		paths, err = storage.List(ctx, fs, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"shared/foo"}, paths)
+	})
+}
+
+func TestLoadPolicy(t *testing.T) {
+	policy, err := storage.LoadPolicy(strings.NewReader(`{"rules": [{"effect": "allow", "paths": ["*"], "scopes": "read,sign"}]}`))
+	require.NoError(t, err)
+	assert.True(t, policy.Allowed("", "foo", storage.ScopeRead|storage.ScopeSignURL))
+	assert.False(t, policy.Allowed("", "foo/bar", storage.ScopeRead))
+	assert.False(t, policy.Allowed("", "foo", storage.ScopeWrite))
+
+	for _, invalid := range []string{
+		`{"rules": [{"effect": "maybe"}]}`,
+		`{"rules": [{"effect": "allow", "scopes": "execute"}]}`,
+		`{"rules": [{"effect": "allow", "paths": ["[a"]}]}`,
+		`{"rules": [{"effect": "allow", "path": "a"}]}`,
+	} {
+		_, err := storage.LoadPolicy(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPolicyWrapper_URL(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		policy, err := storage.LoadPolicy(strings.NewReader(`
+rules:
+  - effect: allow
+    paths: ["shared/**"]
+    scopes: read,sign
+`))
+		require.NoError(t, err)
+		fs := storage.NewPolicyWrapper(mem, policy)
+
+		// memoryFS doesn't support URLs, but they are allowed
+		_, err = fs.URL(ctx, "shared/foo", &storage.SignedURLOptions{Method: "get"})
+		assert.ErrorIs(t, err, storage.ErrNotImplemented)
+
+		for _, method := range []string{"PUT", "put", "POST", "delete"} {
+			_, err = fs.URL(ctx, "shared/foo", &storage.SignedURLOptions{Method: method})
+			assert.ErrorIs(t, err, storage.ErrPermissionDenied, method)
+		}
+		_, err = fs.URL(ctx, "shared/foo", &storage.SignedURLOptions{Method: "PATCH"})
+		assert.ErrorContains(t, err, "unsupported signed URL method")
+	})
+}
@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Interaction is a call to an FS and its result, recorded by a RecordingWrapper and served by a ReplayFS.
+type Interaction struct {
+	Op   Op     `json:"op"`
+	Path string `json:"path"`
+
+	// The options of the call, depending on Op.
+	ReaderOptions *ReaderOptions    `json:"reader_options,omitempty"`
+	WriterOptions *WriterOptions    `json:"writer_options,omitempty"`
+	URLOptions    *SignedURLOptions `json:"url_options,omitempty"`
+
+	// Attributes are the attributes returned by Open and Attributes.
+	Attributes *Attributes `json:"attributes,omitempty"`
+	// Content is the content read by Open, or written by Create.
+	Content []byte `json:"content,omitempty"`
+	// Paths are the paths walked by Walk.
+	Paths []string `json:"paths,omitempty"`
+	// URL is the URL returned by URL.
+	URL string `json:"url,omitempty"`
+
+	// Error is the error returned by the call.
+	Error *RecordedError `json:"error,omitempty"`
+	// CloseError is the error returned by Close, for Create.
+	CloseError *RecordedError `json:"close_error,omitempty"`
+}
+
+// RecordedError is an error recorded by a RecordingWrapper, returned by a ReplayFS.
+type RecordedError struct {
+	Message string `json:"message"`
+	// Class is the kind of the original error, e.g. "permission_denied", so errors such as IsNotExist
+	// ones can be replayed.
+	Class string `json:"class,omitempty"`
+}
+
+func newRecordedError(err error) *RecordedError {
+	if err == nil {
+		return nil
+	}
+
+	return &RecordedError{Message: err.Error(), Class: errorClass(err)}
+}
+
+// Error implements error
+func (e *RecordedError) Error() string {
+	return e.Message
+}
+
+// classErrors are the errors of the classes of errorClass which are checked with errors.Is.
+var classErrors = map[string]error{
+	"permission_denied": ErrPermissionDenied,
+	"checksum_mismatch": ErrChecksumMismatch,
+	"locked":            ErrObjectLocked,
+	"not_implemented":   ErrNotImplemented,
+	"canceled":          context.Canceled,
+	"deadline_exceeded": context.DeadlineExceeded,
+}
+
+// Unwrap returns the error of the class of e, e.g. ErrPermissionDenied, if any.
+func (e *RecordedError) Unwrap() error {
+	return classErrors[e.Class]
+}
+
+// replay recreates the recorded error of path.  It satisfies the same checks as the original error, e.g.
+// IsNotExist, or errors.Is with ErrPermissionDenied.
+func (e *RecordedError) replay(path string) error {
+	switch {
+	case e == nil:
+		return nil
+	case e.Class == "not_exist":
+		return &notExistError{Path: path}
+	case e.Class == "exist":
+		return &existError{Path: path}
+	}
+
+	return e
+}
+
+// NewRecordingWrapper creates an FS which records the calls to fs and their results, to be saved as a fixture
+// with WriteFixture and served by a ReplayFS, e.g. to record calls to Google Cloud Storage once and replay
+// them in tests.
+//
+// Open reads the whole content of files when they are opened, so it can be recorded.
+func NewRecordingWrapper(fs FS) *RecordingWrapper {
+	return &RecordingWrapper{
+		fs: fs,
+	}
+}
+
+// RecordingWrapper is an FS which records interactions with an FS.
+type RecordingWrapper struct {
+	fs FS
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+// copyOptions copies options, as FS may modify them.
+func copyOptions[T any](options *T) *T {
+	if options == nil {
+		return nil
+	}
+	c := *options
+
+	return &c
+}
+
+// add adds a copy of i to the recorded interactions, in the order of the calls, and returns its index.
+func (r *RecordingWrapper) add(i *Interaction) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactions = append(r.interactions, *i)
+
+	return len(r.interactions) - 1
+}
+
+// update replaces the recorded interaction at index with a copy of i, once its results are known.
+func (r *RecordingWrapper) update(index int, i *Interaction) {
+	r.mu.Lock()
+	r.interactions[index] = *i
+	r.mu.Unlock()
+}
+
+// Interactions returns the interactions recorded so far.
+func (r *RecordingWrapper) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	interactions := make([]Interaction, len(r.interactions))
+	copy(interactions, r.interactions)
+
+	return interactions
+}
+
+// WriteFixture writes the interactions recorded so far to w, as JSON to be read by LoadFixture.
+func (r *RecordingWrapper) WriteFixture(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r.Interactions())
+}
+
+// Open implements FS.
+func (r *RecordingWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	i := &Interaction{Op: OpOpen, Path: path, ReaderOptions: copyOptions(options)}
+	index := r.add(i)
+	defer r.update(index, i)
+
+	f, err := r.fs.Open(ctx, path, options)
+	if err != nil {
+		i.Error = newRecordedError(err)
+
+		return nil, err
+	}
+	defer f.Close()
+
+	attrs := f.Attributes
+	i.Attributes = &attrs
+	if i.Content, err = io.ReadAll(f); err != nil {
+		i.Error = newRecordedError(err)
+
+		return nil, err
+	}
+
+	return &File{
+		ReadCloser: io.NopCloser(bytes.NewReader(i.Content)),
+		Attributes: f.Attributes,
+	}, nil
+}
+
+// Attributes implements FS.
+func (r *RecordingWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	i := &Interaction{Op: OpAttributes, Path: path, ReaderOptions: copyOptions(options)}
+	index := r.add(i)
+	defer r.update(index, i)
+
+	attrs, err := r.fs.Attributes(ctx, path, options)
+	if err != nil {
+		i.Error = newRecordedError(err)
+
+		return nil, err
+	}
+	recorded := *attrs
+	i.Attributes = &recorded
+
+	return attrs, nil
+}
+
+// recordingWriter records the content written.
+type recordingWriter struct {
+	io.WriteCloser
+	buf   bytes.Buffer
+	r     *RecordingWrapper
+	index int
+	i     *Interaction
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.buf.Write(p[:n])
+
+	return n, err
+}
+
+func (w *recordingWriter) Close() error {
+	err := w.WriteCloser.Close()
+	w.i.Content = w.buf.Bytes()
+	w.i.CloseError = newRecordedError(err)
+	w.r.update(w.index, w.i)
+
+	return err
+}
+
+// Create implements FS.
+func (r *RecordingWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	i := &Interaction{Op: OpCreate, Path: path, WriterOptions: copyOptions(options)}
+	index := r.add(i)
+
+	wc, err := r.fs.Create(ctx, path, options)
+	if err != nil {
+		i.Error = newRecordedError(err)
+		r.update(index, i)
+
+		return nil, err
+	}
+
+	return &recordingWriter{WriteCloser: wc, r: r, index: index, i: i}, nil
+}
+
+// Delete implements FS.
+func (r *RecordingWrapper) Delete(ctx context.Context, path string) error {
+	i := &Interaction{Op: OpDelete, Path: path}
+	index := r.add(i)
+	defer r.update(index, i)
+
+	err := r.fs.Delete(ctx, path)
+	i.Error = newRecordedError(err)
+
+	return err
+}
+
+// Walk implements FS.
+func (r *RecordingWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	i := &Interaction{Op: OpWalk, Path: path}
+	index := r.add(i)
+	defer r.update(index, i)
+
+	err := r.fs.Walk(ctx, path, func(path string) error {
+		i.Paths = append(i.Paths, path)
+
+		return fn(path)
+	})
+	i.Error = newRecordedError(err)
+
+	return err
+}
+
+// URL implements FS.
+func (r *RecordingWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	i := &Interaction{Op: OpURL, Path: path, URLOptions: copyOptions(options)}
+	index := r.add(i)
+	defer r.update(index, i)
+
+	url, err := r.fs.URL(ctx, path, options)
+	i.URL = url
+	i.Error = newRecordedError(err)
+
+	return url, err
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrReplayMiss is returned (wrapped in a *ReplayMissError) when a call to a ReplayFS matches no
+// recorded interaction.
+var ErrReplayMiss = errors.New("no recorded interaction")
+
+// ReplayMissError is returned when a call to a ReplayFS matches no recorded interaction.
+// It wraps ErrReplayMiss.
+type ReplayMissError struct {
+	Call *Interaction
+	// Diff is the difference between the call and the closest recorded interaction, if any.
+	Diff string
+}
+
+// Error implements error
+func (e *ReplayMissError) Error() string {
+	msg := fmt.Sprintf("storage %v: %v for %v", e.Call.Path, ErrReplayMiss, e.Call.Op)
+	if e.Diff != "" {
+		msg += ", closest interaction (-recorded +call):\n" + e.Diff
+	}
+
+	return msg
+}
+
+// Unwrap returns ErrReplayMiss.
+func (e *ReplayMissError) Unwrap() error { return ErrReplayMiss }
+
+// ReplayMode defines how a ReplayFS matches calls with the recorded interactions.
+type ReplayMode int
+
+const (
+	// ReplayStrict requires calls in the order of the recorded interactions, with the same options, and
+	// the same content for Create.
+	ReplayStrict ReplayMode = iota
+	// ReplayLenient matches calls with the first interaction with the same operation and path, whatever
+	// their order and options.  Interactions are used once, except for the last matching one which is reused.
+	ReplayLenient
+)
+
+// LoadFixture reads the interactions written by RecordingWrapper.WriteFixture.
+func LoadFixture(r io.Reader) ([]Interaction, error) {
+	var interactions []Interaction
+	if err := json.NewDecoder(r).Decode(&interactions); err != nil {
+		return nil, fmt.Errorf("loading fixture: %w", err)
+	}
+
+	return interactions, nil
+}
+
+// NewReplayFS creates an FS which serves the interactions recorded by a RecordingWrapper, matching calls
+// according to mode.  Calls which don't match return a *ReplayMissError.
+func NewReplayFS(interactions []Interaction, mode ReplayMode) *ReplayFS {
+	return &ReplayFS{
+		interactions: interactions,
+		used:         make([]bool, len(interactions)),
+		mode:         mode,
+	}
+}
+
+// ReplayFS is an FS serving recorded interactions.
+type ReplayFS struct {
+	mode ReplayMode
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+	next         int
+}
+
+// Remaining returns the interactions which were not replayed.
+func (r *ReplayFS) Remaining() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var remaining []Interaction
+	for i, used := range r.used {
+		if !used {
+			remaining = append(remaining, r.interactions[i])
+		}
+	}
+
+	return remaining
+}
+
+// match returns the interaction matching call.
+func (r *ReplayFS) match(call *Interaction) (*Interaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.mode == ReplayStrict {
+		if r.next >= len(r.interactions) {
+			return nil, &ReplayMissError{Call: call}
+		}
+		i := &r.interactions[r.next]
+		if diff := diffInteractions(request(i), request(call)); diff != "" {
+			return nil, &ReplayMissError{Call: call, Diff: diff}
+		}
+		r.used[r.next] = true
+		r.next++
+
+		return i, nil
+	}
+
+	last := -1
+	for j := range r.interactions {
+		i := &r.interactions[j]
+		if i.Op != call.Op || i.Path != call.Path {
+			continue
+		}
+		if !r.used[j] {
+			r.used[j] = true
+
+			return i, nil
+		}
+		last = j
+	}
+	if last >= 0 {
+		return &r.interactions[last], nil
+	}
+
+	// Show the closest interaction, with the same operation
+	miss := &ReplayMissError{Call: call}
+	for j := range r.interactions {
+		if i := &r.interactions[j]; i.Op == call.Op {
+			miss.Diff = diffInteractions(request(i), request(call))
+
+			break
+		}
+	}
+
+	return nil, miss
+}
+
+// request returns the part of i describing the call.
+func request(i *Interaction) *Interaction {
+	return &Interaction{
+		Op:            i.Op,
+		Path:          i.Path,
+		ReaderOptions: i.ReaderOptions,
+		WriterOptions: i.WriterOptions,
+		URLOptions:    i.URLOptions,
+	}
+}
+
+// diffInteractions returns a line diff of the JSON of recorded and call, or "" if they are equal.
+func diffInteractions(recorded, call *Interaction) string {
+	a, _ := json.MarshalIndent(recorded, "", "  ")
+	b, _ := json.MarshalIndent(call, "", "  ")
+	if bytes.Equal(a, b) {
+		return ""
+	}
+
+	aLines, bLines := strings.Split(string(a), "\n"), strings.Split(string(b), "\n")
+	var diff strings.Builder
+	for i := 0; i < len(aLines) || i < len(bLines); i++ {
+		switch {
+		case i >= len(bLines):
+			fmt.Fprintf(&diff, "-%s\n", aLines[i])
+		case i >= len(aLines):
+			fmt.Fprintf(&diff, "+%s\n", bLines[i])
+		case aLines[i] != bLines[i]:
+			fmt.Fprintf(&diff, "-%s\n+%s\n", aLines[i], bLines[i])
+		default:
+			fmt.Fprintf(&diff, " %s\n", aLines[i])
+		}
+	}
+
+	return diff.String()
+}
+
+// Open implements FS.
+func (r *ReplayFS) Open(_ context.Context, path string, options *ReaderOptions) (*File, error) {
+	i, err := r.match(&Interaction{Op: OpOpen, Path: path, ReaderOptions: options})
+	if err != nil {
+		return nil, err
+	}
+	if err := i.Error.replay(path); err != nil {
+		return nil, err
+	}
+
+	f := &File{ReadCloser: io.NopCloser(bytes.NewReader(i.Content))}
+	if i.Attributes != nil {
+		f.Attributes = *i.Attributes
+	}
+
+	return f, nil
+}
+
+// Attributes implements FS.
+func (r *ReplayFS) Attributes(_ context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	i, err := r.match(&Interaction{Op: OpAttributes, Path: path, ReaderOptions: options})
+	if err != nil {
+		return nil, err
+	}
+	if err := i.Error.replay(path); err != nil {
+		return nil, err
+	}
+
+	attrs := Attributes{}
+	if i.Attributes != nil {
+		attrs = *i.Attributes
+	}
+
+	return &attrs, nil
+}
+
+// replayWriter returns the recorded error on Close, after checking the content in strict mode.
+type replayWriter struct {
+	bytes.Buffer
+	i      *Interaction
+	strict bool
+}
+
+func (w *replayWriter) Close() error {
+	if w.strict && !bytes.Equal(w.Bytes(), w.i.Content) {
+		return &ReplayMissError{
+			Call: w.i,
+			Diff: fmt.Sprintf("-content: %q\n+content: %q\n", w.i.Content, w.Bytes()),
+		}
+	}
+
+	return w.i.CloseError.replay(w.i.Path)
+}
+
+// Create implements FS.  The content written is discarded.
+func (r *ReplayFS) Create(_ context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	i, err := r.match(&Interaction{Op: OpCreate, Path: path, WriterOptions: options})
+	if err != nil {
+		return nil, err
+	}
+	if err := i.Error.replay(path); err != nil {
+		return nil, err
+	}
+
+	return &replayWriter{i: i, strict: r.mode == ReplayStrict}, nil
+}
+
+// Delete implements FS.
+func (r *ReplayFS) Delete(_ context.Context, path string) error {
+	i, err := r.match(&Interaction{Op: OpDelete, Path: path})
+	if err != nil {
+		return err
+	}
+
+	return i.Error.replay(path)
+}
+
+// Walk implements FS.
+func (r *ReplayFS) Walk(_ context.Context, path string, fn WalkFn) error {
+	i, err := r.match(&Interaction{Op: OpWalk, Path: path})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range i.Paths {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return i.Error.replay(path)
+}
+
+// URL implements FS.
+func (r *ReplayFS) URL(_ context.Context, path string, options *SignedURLOptions) (string, error) {
+	i, err := r.match(&Interaction{Op: OpURL, Path: path, URLOptions: options})
+	if err != nil {
+		return "", err
+	}
+
+	return i.URL, i.Error.replay(path)
+}
@@ -0,0 +1,208 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+// recordFixture records calls to a memoryFS, and returns the fixture.
+func recordFixture(t *testing.T) []storage.Interaction {
+	t.Helper()
+	ctx := context.Background()
+
+	var fixture bytes.Buffer
+	withMem(func(mem storage.FS) {
+		fs := storage.NewRecordingWrapper(mem)
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), &storage.WriterOptions{
+			Attributes: storage.Attributes{ContentType: "text/plain"},
+		}))
+		data, err := storage.Read(ctx, fs, "foo", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(data))
+		_, err = fs.Attributes(ctx, "missing", nil)
+		require.Error(t, err)
+		_, err = storage.List(ctx, fs, "")
+		require.NoError(t, err)
+
+		require.NoError(t, fs.WriteFixture(&fixture))
+	})
+
+	interactions, err := storage.LoadFixture(&fixture)
+	require.NoError(t, err)
+
+	return interactions
+}
+
+func TestRecordingWrapper(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		fs := storage.NewRecordingWrapper(mem)
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+		assert.NotEmpty(t, fs.Interactions())
+	})
+}
+
+func TestRecordingWrapper_concurrent(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		fs := storage.NewRecordingWrapper(mem)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), nil))
+				_ = fs.Interactions()
+			}()
+		}
+		wg.Wait()
+
+		interactions := fs.Interactions()
+		require.Len(t, interactions, 4)
+		for _, i := range interactions {
+			assert.Equal(t, "bar", string(i.Content))
+		}
+	})
+}
+
+func TestReplayFS_strict(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewReplayFS(recordFixture(t), storage.ReplayStrict)
+
+	require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), &storage.WriterOptions{
+		Attributes: storage.Attributes{ContentType: "text/plain"},
+	}))
+
+	f, err := fs.Open(ctx, "foo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", f.ContentType)
+	require.NoError(t, f.Close())
+
+	// A call out of order is a miss, with a diff
+	_, err = fs.Open(ctx, "missing", nil)
+	assert.ErrorIs(t, err, storage.ErrReplayMiss)
+	var miss *storage.ReplayMissError
+	require.True(t, errors.As(err, &miss))
+	assert.Contains(t, miss.Diff, `-  "op": "attrs"`)
+	assert.Contains(t, miss.Diff, `+  "op": "open"`)
+
+	_, err = fs.Attributes(ctx, "missing", nil)
+	assert.True(t, storage.IsNotExist(err))
+
+	paths, err := storage.List(ctx, fs, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, paths)
+	assert.Empty(t, fs.Remaining())
+
+	_, err = fs.Open(ctx, "foo", nil)
+	assert.ErrorIs(t, err, storage.ErrReplayMiss)
+}
+
+func TestReplayFS_strictContent(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewReplayFS(recordFixture(t), storage.ReplayStrict)
+
+	err := storage.Write(ctx, fs, "foo", []byte("baz"), &storage.WriterOptions{
+		Attributes: storage.Attributes{ContentType: "text/plain"},
+	})
+	assert.ErrorIs(t, err, storage.ErrReplayMiss)
+}
+
+func TestReplayFS_lenient(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewReplayFS(recordFixture(t), storage.ReplayLenient)
+
+	// Any order and options
+	_, err := fs.Attributes(ctx, "missing", &storage.ReaderOptions{ReadCompressed: true})
+	assert.True(t, storage.IsNotExist(err))
+	for i := 0; i < 2; i++ {
+		data, err := storage.Read(ctx, fs, "foo", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(data))
+	}
+	assert.Len(t, fs.Remaining(), 2)
+
+	_, err = fs.Open(ctx, "bar", nil)
+	assert.ErrorIs(t, err, storage.ErrReplayMiss)
+}
+
+func TestReplayFS_errors(t *testing.T) {
+	ctx := context.Background()
+
+	var errNotExist, errExist error
+	withMem(func(mem storage.FS) {
+		_, errNotExist = mem.Open(ctx, "foo", nil)
+		testutils.Create(t, mem, "foo", "bar")
+		errExist = storage.Write(ctx, mem, "foo", []byte("bar"), &storage.WriterOptions{IfNotExist: true})
+	})
+
+	tests := []struct {
+		name  string
+		err   error
+		check func(err error) bool
+	}{
+		{name: "not_exist", err: errNotExist, check: storage.IsNotExist},
+		{name: "exist", err: errExist, check: storage.IsExist},
+		{
+			name:  "permission_denied",
+			err:   &storage.PermissionError{Path: "foo", Op: storage.OpDelete, Scope: storage.ScopeDelete},
+			check: func(err error) bool { return errors.Is(err, storage.ErrPermissionDenied) },
+		},
+		{
+			name:  "checksum_mismatch",
+			err:   fmt.Errorf("storage foo: %w", storage.ErrChecksumMismatch),
+			check: func(err error) bool { return errors.Is(err, storage.ErrChecksumMismatch) },
+		},
+		{
+			name:  "locked",
+			err:   &storage.LockedError{Path: "foo", LegalHold: true},
+			check: func(err error) bool { return errors.Is(err, storage.ErrObjectLocked) },
+		},
+		{
+			name:  "not_implemented",
+			err:   storage.ErrNotImplemented,
+			check: func(err error) bool { return errors.Is(err, storage.ErrNotImplemented) },
+		},
+		{
+			name:  "canceled",
+			err:   context.Canceled,
+			check: func(err error) bool { return errors.Is(err, context.Canceled) },
+		},
+		{
+			name:  "deadline_exceeded",
+			err:   context.DeadlineExceeded,
+			check: func(err error) bool { return errors.Is(err, context.DeadlineExceeded) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.True(t, tt.check(tt.err))
+
+			mockFS := storage.NewMockFS()
+			mockFS.On("Delete", mock.Anything, "foo").Return(tt.err)
+			recorder := storage.NewRecordingWrapper(mockFS)
+			require.Error(t, recorder.Delete(ctx, "foo"))
+
+			var fixture bytes.Buffer
+			require.NoError(t, recorder.WriteFixture(&fixture))
+			interactions, err := storage.LoadFixture(&fixture)
+			require.NoError(t, err)
+
+			err = storage.NewReplayFS(interactions, storage.ReplayStrict).Delete(ctx, "foo")
+			assert.True(t, tt.check(err))
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package storage
 
-import "strings"
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
 
 type Scope int
 
@@ -39,3 +43,69 @@ func (s Scope) String() string {
 
 	return strings.Join(scopes, ",")
 }
+
+var scopeNames = map[string]Scope{
+	"none":   0,
+	"read":   ScopeRead,
+	"write":  ScopeWrite,
+	"delete": ScopeDelete,
+	"sign":   ScopeSignURL,
+}
+
+// MarshalText implements encoding.TextMarshaler, using the format of String.
+func (s Scope) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, parsing the format of String: comma-separated scope
+// names among "read", "write", "delete" and "sign", or "none".
+func (s *Scope) UnmarshalText(text []byte) error {
+	var scope Scope
+	for _, name := range strings.Split(string(text), ",") {
+		v, ok := scopeNames[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown scope: %q", name)
+		}
+		scope |= v
+	}
+	*s = scope
+
+	return nil
+}
+
+// opScope returns the scope required by op on path.  options are the options of OpURL, the scope depends on
+// the method of the URL: it fails with a *PermissionError for methods other than GET, HEAD, PUT, POST and
+// DELETE.
+func opScope(op Op, path string, options *SignedURLOptions) (Scope, error) {
+	switch op {
+	case OpOpen, OpAttributes, OpWalk:
+		return ScopeRead, nil
+	case OpCreate:
+		return ScopeWrite, nil
+	case OpDelete:
+		return ScopeDelete, nil
+	case OpURL:
+		method := DefaultSignedURLMethod
+		if options != nil && options.Method != "" {
+			method = options.Method
+		}
+		// Methods are case-insensitive for some FS, e.g. Google Cloud Storage
+		switch strings.ToUpper(method) {
+		case http.MethodGet, http.MethodHead:
+			return ScopeSignURL | ScopeRead, nil
+		case http.MethodPut, http.MethodPost:
+			return ScopeSignURL | ScopeWrite, nil
+		case http.MethodDelete:
+			return ScopeSignURL | ScopeDelete, nil
+		}
+
+		// No scope allows the method
+		return 0, fmt.Errorf("unsupported signed URL method %q: %w", method, &PermissionError{
+			Path:  path,
+			Op:    op,
+			Scope: ScopeSignURL,
+		})
+	}
+
+	return 0, nil
+}
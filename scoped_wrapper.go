@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// NewScopedWrapper creates an FS which only allows the operations within scope, e.g. to hand a read-only
+// view of an FS to untrusted code.  Other operations fail with a *PermissionError.
+//
+// ScopeRead allows Open, Attributes and Walk, ScopeWrite allows Create and ScopeDelete allows Delete.
+// URL requires ScopeSignURL, along with the scope of the method of the URL: ScopeRead for GET and HEAD,
+// ScopeWrite for PUT and POST, and ScopeDelete for DELETE.  Methods are case-insensitive, others are rejected.
+func NewScopedWrapper(fs FS, scope Scope) FS {
+	return &scopedWrapper{
+		fs:    fs,
+		scope: scope,
+	}
+}
+
+type scopedWrapper struct {
+	fs    FS
+	scope Scope
+}
+
+func (s *scopedWrapper) check(op Op, path string, options *SignedURLOptions) error {
+	required, err := opScope(op, path, options)
+	if err != nil {
+		return err
+	}
+	if !s.scope.Has(required) {
+		return &PermissionError{Path: path, Op: op, Scope: required}
+	}
+
+	return nil
+}
+
+// Open implements FS.
+func (s *scopedWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	if err := s.check(OpOpen, path, nil); err != nil {
+		return nil, err
+	}
+
+	return s.fs.Open(ctx, path, options)
+}
+
+// Attributes implements FS.
+func (s *scopedWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	if err := s.check(OpAttributes, path, nil); err != nil {
+		return nil, err
+	}
+
+	return s.fs.Attributes(ctx, path, options)
+}
+
+// Create implements FS.
+func (s *scopedWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	if err := s.check(OpCreate, path, nil); err != nil {
+		return nil, err
+	}
+
+	return s.fs.Create(ctx, path, options)
+}
+
+// Delete implements FS.
+func (s *scopedWrapper) Delete(ctx context.Context, path string) error {
+	if err := s.check(OpDelete, path, nil); err != nil {
+		return err
+	}
+
+	return s.fs.Delete(ctx, path)
+}
+
+// Walk implements FS.
+func (s *scopedWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	if err := s.check(OpWalk, path, nil); err != nil {
+		return err
+	}
+
+	return s.fs.Walk(ctx, path, fn)
+}
+
+// URL implements FS.
+func (s *scopedWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	if err := s.check(OpURL, path, options); err != nil {
+		return "", err
+	}
+
+	return s.fs.URL(ctx, path, options)
+}
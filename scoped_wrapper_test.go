@@ -0,0 +1,60 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func TestScopedWrapper(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		fs := storage.NewScopedWrapper(mem, storage.ScopeRWD)
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+	})
+}
+
+func TestScopedWrapper_denied(t *testing.T) {
+	ctx := context.Background()
+
+	withLocal(func(local storage.FS) {
+		require.NoError(t, storage.Write(ctx, local, "foo", []byte("bar"), nil))
+
+		fs := storage.NewScopedWrapper(local, storage.ScopeRead)
+		testutils.OpenExists(t, fs, "foo", "bar")
+		_, err := storage.List(ctx, fs, "")
+		require.NoError(t, err)
+
+		err = storage.Write(ctx, fs, "foo", []byte("baz"), nil)
+		assert.ErrorIs(t, err, storage.ErrPermissionDenied)
+		var permErr *storage.PermissionError
+		require.True(t, errors.As(err, &permErr))
+		assert.Equal(t, storage.OpCreate, permErr.Op)
+		assert.Equal(t, storage.ScopeWrite, permErr.Scope)
+
+		assert.ErrorIs(t, fs.Delete(ctx, "foo"), storage.ErrPermissionDenied)
+		_, err = fs.URL(ctx, "foo", nil)
+		assert.ErrorIs(t, err, storage.ErrPermissionDenied)
+
+		// URL requires the scope of the method
+		fs = storage.NewScopedWrapper(local, storage.ScopeRead|storage.ScopeSignURL)
+		_, err = fs.URL(ctx, "foo", nil)
+		require.NoError(t, err)
+		for _, method := range []string{"PUT", "put", "POST", "DELETE", "delete"} {
+			_, err = fs.URL(ctx, "foo", &storage.SignedURLOptions{Method: method})
+			assert.ErrorIs(t, err, storage.ErrPermissionDenied, method)
+		}
+
+		// Unknown methods are rejected rather than treated as reads
+		_, err = fs.URL(ctx, "foo", &storage.SignedURLOptions{Method: "PATCH"})
+		assert.ErrorContains(t, err, "unsupported signed URL method")
+		var permissionErr *storage.PermissionError
+		assert.ErrorAs(t, err, &permissionErr)
+	})
+}
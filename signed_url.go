@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignedURL is returned when a signed URL is expired, or its signature doesn't match.
+var ErrInvalidSignedURL = errors.New("invalid signed URL")
+
+// URLSigner creates HMAC-signed URLs pointing at the handler of NewURLHandler, for FS implementations
+// which can't sign URLs themselves, see MemoryFSOptions and LocalFSOptions.
+type URLSigner struct {
+	// BaseURL is the URL the handler is served at, e.g. "http://localhost:8080/storage/".  The paths are
+	// appended to it.
+	BaseURL string
+	// Key is the secret key of the HMAC-SHA256 signatures.  It is required: URLs signed with an empty key
+	// could be forged.
+	Key []byte
+
+	// Clock is used for the expiry of the URLs.  Defaults to the system clock.
+	Clock Clock
+}
+
+// errNoKey is returned when signing or verifying URLs with an empty URLSigner.Key.
+var errNoKey = errors.New("URLSigner.Key is empty")
+
+// SignURL returns a URL of path valid for options.Expiry, for options.Method.
+func (s *URLSigner) SignURL(path string, options *SignedURLOptions) (string, error) {
+	if len(s.Key) == 0 {
+		return "", errNoKey
+	}
+	// Don't modify the options of the caller
+	signedOptions := &SignedURLOptions{}
+	if options != nil {
+		*signedOptions = *options
+	}
+	signedOptions.applyDefaults()
+	options = signedOptions
+
+	switch options.Method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+	default:
+		return "", fmt.Errorf("storage %v: unsupported signed URL method %q", path, options.Method)
+	}
+
+	u, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing base URL: %w", err)
+	}
+	// The path is signed as is: unlike JoinPath, don't clean it, only escape its segments
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + strings.Join(segments, "/")
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + path
+
+	expires := strconv.FormatInt(clockOrDefault(s.Clock).Now().Add(options.Expiry).Unix(), 10)
+	q := url.Values{}
+	q.Set("method", options.Method)
+	q.Set("expires", expires)
+	q.Set("signature", s.signature(options.Method, path, expires))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+func (s *URLSigner) signature(method, path, expires string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(method + "\n" + path + "\n" + expires))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path returns the path of the object of r, relative to the BaseURL.
+func (s *URLSigner) path(r *http.Request) (string, error) {
+	u, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing base URL: %w", err)
+	}
+	prefix := strings.TrimSuffix(u.Path, "/") + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		return "", &notExistError{Path: r.URL.Path}
+	}
+
+	return strings.TrimPrefix(r.URL.Path, prefix), nil
+}
+
+// verify checks that r was signed for the method of the request (HEAD for GET), and is not expired.
+func (s *URLSigner) verify(r *http.Request, path string) error {
+	if len(s.Key) == 0 {
+		return fmt.Errorf("storage %v: %w: %w", path, ErrInvalidSignedURL, errNoKey)
+	}
+	q := r.URL.Query()
+	method, expires := q.Get("method"), q.Get("expires")
+
+	if !hmac.Equal([]byte(s.signature(method, path, expires)), []byte(q.Get("signature"))) {
+		return fmt.Errorf("storage %v: %w: bad signature", path, ErrInvalidSignedURL)
+	}
+
+	if method != r.Method && (method != http.MethodGet || r.Method != http.MethodHead) {
+		return fmt.Errorf("storage %v: %w: signed for %v", path, ErrInvalidSignedURL, method)
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("storage %v: %w: bad expiry", path, ErrInvalidSignedURL)
+	}
+	if !clockOrDefault(s.Clock).Now().Before(time.Unix(unix, 0)) {
+		return fmt.Errorf("storage %v: %w: expired", path, ErrInvalidSignedURL)
+	}
+
+	return nil
+}
+
+// NewURLHandler creates an http.Handler serving and accepting the objects of fs at the URLs signed by
+// signer: GET and HEAD serve objects, PUT creates them and DELETE deletes them.  Requests whose signature
+// is invalid, expired, or for another method are forbidden.
+//
+// The handler must be served at the path of signer.BaseURL, without cleaning the paths of the requests
+// (unlike http.ServeMux), since the paths are signed as is.  It fails if signer.Key is empty.
+func NewURLHandler(fs FS, signer *URLSigner) (http.Handler, error) {
+	if len(signer.Key) == 0 {
+		return nil, errNoKey
+	}
+
+	return &urlHandler{
+		fs:     fs,
+		signer: signer,
+	}, nil
+}
+
+type urlHandler struct {
+	fs     FS
+	signer *URLSigner
+}
+
+// ServeHTTP implements http.Handler.
+func (h *urlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, err := h.signer.path(r)
+	if err != nil {
+		h.error(w, err)
+
+		return
+	}
+	if err := h.signer.verify(r, path); err != nil {
+		h.error(w, err)
+
+		return
+	}
+
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		f, err := h.fs.Open(ctx, path, nil)
+		if err != nil {
+			h.error(w, err)
+
+			return
+		}
+		defer f.Close()
+
+		setHeaders(w.Header(), &f.Attributes)
+		_, _ = io.Copy(w, f)
+
+	case http.MethodHead:
+		attrs, err := h.fs.Attributes(ctx, path, nil)
+		if err != nil {
+			h.error(w, err)
+
+			return
+		}
+		setHeaders(w.Header(), attrs)
+		w.Header().Set("Content-Length", strconv.FormatInt(attrs.Size, 10))
+
+	case http.MethodPut:
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		wc, err := h.fs.Create(ctx, path, &WriterOptions{
+			Attributes: Attributes{
+				ContentType:     r.Header.Get("Content-Type"),
+				ContentEncoding: r.Header.Get("Content-Encoding"),
+			},
+		})
+		if err != nil {
+			h.error(w, err)
+
+			return
+		}
+		if _, err := io.Copy(wc, r.Body); err != nil {
+			AbortWrite(cancel, wc)
+			h.error(w, err)
+
+			return
+		}
+		if err := wc.Close(); err != nil {
+			h.error(w, err)
+
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		if err := h.fs.Delete(ctx, path); err != nil {
+			h.error(w, err)
+
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func setHeaders(header http.Header, attrs *Attributes) {
+	if attrs.ContentType != "" {
+		header.Set("Content-Type", attrs.ContentType)
+	}
+	if attrs.ContentEncoding != "" {
+		header.Set("Content-Encoding", attrs.ContentEncoding)
+	}
+	if !attrs.ModTime.IsZero() {
+		header.Set("Last-Modified", attrs.ModTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+func (h *urlHandler) error(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), HTTPStatus(err))
+}
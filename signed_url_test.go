@@ -0,0 +1,195 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+// withURLHandler serves the signed URLs of the FS created by newFS.
+func withURLHandler(t *testing.T, newFS func(*storage.URLSigner) storage.FS, clock storage.Clock, cb func(storage.FS)) {
+	t.Helper()
+
+	signer := &storage.URLSigner{Key: []byte("secret"), Clock: clock}
+	var h http.Handler
+	// Not served by an http.ServeMux, which cleans the paths
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	signer.BaseURL = srv.URL + "/storage/"
+	fs := newFS(signer)
+	var err error
+	h, err = storage.NewURLHandler(fs, signer)
+	require.NoError(t, err)
+	cb(fs)
+}
+
+func doRequest(t *testing.T, method, url string, body string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp, string(data)
+}
+
+func signURL(t *testing.T, fs storage.FS, path, method string) string {
+	t.Helper()
+
+	url, err := fs.URL(context.Background(), path, &storage.SignedURLOptions{Method: method})
+	require.NoError(t, err)
+
+	return url
+}
+
+func TestURLHandler(t *testing.T) {
+	newMem := func(signer *storage.URLSigner) storage.FS {
+		return storage.NewMemoryFSWithOptions(&storage.MemoryFSOptions{URLSigner: signer})
+	}
+	withURLHandler(t, newMem, nil, func(fs storage.FS) {
+		resp, _ := doRequest(t, http.MethodPut, signURL(t, fs, "foo/bar baz", http.MethodPut), "hello")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		testutils.OpenExists(t, fs, "foo/bar baz", "hello")
+
+		get := signURL(t, fs, "foo/bar baz", http.MethodGet)
+		resp, body := doRequest(t, http.MethodGet, get, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "hello", body)
+		resp, _ = doRequest(t, http.MethodHead, get, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int64(5), resp.ContentLength)
+
+		// The signature is for a method and a path
+		resp, _ = doRequest(t, http.MethodDelete, get, "")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		resp, _ = doRequest(t, http.MethodGet, strings.Replace(get, "baz", "qux", 1), "")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		resp, _ = doRequest(t, http.MethodGet, signURL(t, fs, "missing", http.MethodGet), "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, _ = doRequest(t, http.MethodDelete, signURL(t, fs, "foo/bar baz", http.MethodDelete), "")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		testutils.OpenNotExists(t, fs, "foo/bar baz")
+	})
+}
+
+func TestURLHandler_Expiry(t *testing.T) {
+	clock := testutils.NewFakeClock(time.Now())
+	newMem := func(signer *storage.URLSigner) storage.FS {
+		return storage.NewMemoryFSWithOptions(&storage.MemoryFSOptions{URLSigner: signer})
+	}
+	withURLHandler(t, newMem, clock, func(fs storage.FS) {
+		testutils.Create(t, fs, "foo", "bar")
+		url, err := fs.URL(context.Background(), "foo", &storage.SignedURLOptions{Expiry: time.Minute})
+		require.NoError(t, err)
+
+		resp, _ := doRequest(t, http.MethodGet, url, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		clock.Advance(time.Minute)
+		resp, _ = doRequest(t, http.MethodGet, url, "")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestURLHandler_local(t *testing.T) {
+	newLocal := func(signer *storage.URLSigner) storage.FS {
+		return storage.NewLocalFSWithOptions(t.TempDir(), &storage.LocalFSOptions{URLSigner: signer})
+	}
+	withURLHandler(t, newLocal, nil, func(fs storage.FS) {
+		resp, _ := doRequest(t, http.MethodPut, signURL(t, fs, "foo/bar", http.MethodPut), "hello")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, body := doRequest(t, http.MethodGet, signURL(t, fs, "foo/bar", http.MethodGet), "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "hello", body)
+	})
+}
+
+func TestURLSigner_options(t *testing.T) {
+	signer := &storage.URLSigner{BaseURL: "http://localhost/storage/", Key: []byte("secret")}
+	options := &storage.SignedURLOptions{}
+	_, err := signer.SignURL("foo", options)
+	require.NoError(t, err)
+	assert.Equal(t, &storage.SignedURLOptions{}, options, "the options of the caller are not modified")
+}
+
+func TestURLSigner_emptyKey(t *testing.T) {
+	for _, key := range [][]byte{nil, {}} {
+		signer := &storage.URLSigner{BaseURL: "http://localhost/storage/", Key: key}
+		_, err := signer.SignURL("foo", nil)
+		require.Error(t, err)
+
+		_, err = storage.NewURLHandler(storage.NewMemoryFS(), signer)
+		require.Error(t, err)
+	}
+}
+
+func TestURLHandler_paths(t *testing.T) {
+	newMem := func(signer *storage.URLSigner) storage.FS {
+		return storage.NewMemoryFSWithOptions(&storage.MemoryFSOptions{URLSigner: signer})
+	}
+	withURLHandler(t, newMem, nil, func(fs storage.FS) {
+		// The paths are signed and served as is, not cleaned
+		for _, path := range []string{"a//b", "./c", "d/../e", "f/./g", "h?i%j#k"} {
+			resp, _ := doRequest(t, http.MethodPut, signURL(t, fs, path, http.MethodPut), path)
+			assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+			testutils.OpenExists(t, fs, path, path)
+
+			resp, body := doRequest(t, http.MethodGet, signURL(t, fs, path, http.MethodGet), "")
+			assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+			assert.Equal(t, path, body)
+		}
+		testutils.OpenNotExists(t, fs, "a/b")
+		testutils.OpenNotExists(t, fs, "c")
+		testutils.OpenNotExists(t, fs, "e")
+	})
+}
+
+func TestURLHandler_errors(t *testing.T) {
+	signer := &storage.URLSigner{BaseURL: "http://localhost/storage/", Key: []byte("secret")}
+	mem := storage.NewMemoryFS()
+	worm := storage.NewWORMWrapper(mem, &storage.WORMOptions{Retention: time.Hour})
+	testutils.Create(t, worm, "foo", "bar")
+	sign := func(path, method string) string {
+		url, err := signer.SignURL(path, &storage.SignedURLOptions{Method: method})
+		require.NoError(t, err)
+
+		return url
+	}
+	serve := func(fs storage.FS, method, url string, body io.Reader) int {
+		rec := httptest.NewRecorder()
+		h, err := storage.NewURLHandler(fs, signer)
+		require.NoError(t, err)
+		h.ServeHTTP(rec, httptest.NewRequest(method, url, body))
+
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusConflict, serve(worm, http.MethodDelete, sign("foo", http.MethodDelete), nil))
+	readOnly := storage.NewScopedWrapper(mem, storage.ScopeRead)
+	assert.Equal(t, http.StatusForbidden, serve(readOnly, http.MethodDelete, sign("foo", http.MethodDelete), nil))
+
+	// A failed read of the body doesn't write the file
+	body := io.MultiReader(strings.NewReader("partial"), &failingReader{})
+	assert.Equal(t, http.StatusInternalServerError, serve(mem, http.MethodPut, sign("bar", http.MethodPut), body))
+	testutils.OpenNotExists(t, mem, "bar")
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
+
+type logAttrsKey struct{}
+
+// WithLogAttrs returns a copy of ctx carrying attrs, which are added to the logs of NewSlogWrapper
+// for the operations using ctx, e.g. a request ID.
+func WithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	all := make([]slog.Attr, 0, len(prev)+len(attrs))
+	all = append(all, prev...)
+	all = append(all, attrs...)
+
+	return context.WithValue(ctx, logAttrsKey{}, all)
+}
+
+// SlogOptions are used to configure NewSlogWrapper.
+type SlogOptions struct {
+	// Level is the level of successful operations.  Defaults to slog.LevelInfo.
+	Level *slog.Level
+	// ErrorLevel is the level of failed operations.  Defaults to slog.LevelError.
+	ErrorLevel *slog.Level
+	// NotExistLevel is the level of operations failing because the path does not exist.
+	// Defaults to slog.LevelDebug.
+	NotExistLevel *slog.Level
+}
+
+func levelOrDefault(level *slog.Level, def slog.Level) slog.Level {
+	if level == nil {
+		return def
+	}
+
+	return *level
+}
+
+// NewSlogWrapper creates an FS which logs all calls to fs with logger, with structured attributes:
+// "fs" (name), "op", "path", "duration" of the call, and "error" and "error_class" for failed operations.
+// The attributes set on the context with WithLogAttrs are added.
+//
+// Open and Create are logged when the File or writer is closed, with the "bytes" read or written and the
+// "transfer_duration" from the return of the call to the end of Close.
+// Walk is logged when it is complete, with the number of "entries" walked.
+func NewSlogWrapper(fs FS, name string, logger *slog.Logger, options *SlogOptions) FS {
+	if options == nil {
+		options = &SlogOptions{}
+	}
+
+	return &slogWrapper{
+		fs:            fs,
+		name:          name,
+		logger:        logger,
+		level:         levelOrDefault(options.Level, slog.LevelInfo),
+		errorLevel:    levelOrDefault(options.ErrorLevel, slog.LevelError),
+		notExistLevel: levelOrDefault(options.NotExistLevel, slog.LevelDebug),
+	}
+}
+
+type slogWrapper struct {
+	fs     FS
+	name   string
+	logger *slog.Logger
+
+	level         slog.Level
+	errorLevel    slog.Level
+	notExistLevel slog.Level
+}
+
+func (l *slogWrapper) log(ctx context.Context, op Op, path string, duration time.Duration, err error, attrs ...slog.Attr) {
+	level := l.level
+	switch {
+	case IsNotExist(err):
+		level = l.notExistLevel
+	case err != nil:
+		level = l.errorLevel
+	}
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	ctxAttrs, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	all := make([]slog.Attr, 0, len(ctxAttrs)+len(attrs)+6)
+	all = append(all,
+		slog.String("fs", l.name),
+		slog.String("op", string(op)),
+		slog.String("path", path),
+		slog.Duration("duration", duration),
+	)
+	all = append(all, attrs...)
+	if err != nil {
+		all = append(all, slog.String("error", err.Error()), slog.String("error_class", errorClass(err)))
+	}
+	all = append(all, ctxAttrs...)
+
+	msg := "storage " + string(op)
+	if err != nil {
+		msg += " failed"
+	}
+	l.logger.LogAttrs(ctx, level, msg, all...)
+}
+
+// countingReadCloser counts the bytes read, and calls close with the count on Close.
+type countingReadCloser struct {
+	io.ReadCloser
+	n     int64
+	close func(n int64, err error) error
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+
+	return n, err
+}
+
+func (r *countingReadCloser) Close() error {
+	return r.close(r.n, r.ReadCloser.Close())
+}
+
+// countingWriteCloser counts the bytes written, and calls close with the count on Close.
+type countingWriteCloser struct {
+	io.WriteCloser
+	n     int64
+	close func(n int64, err error) error
+}
+
+func (w *countingWriteCloser) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.n += int64(n)
+
+	return n, err
+}
+
+func (w *countingWriteCloser) Close() error {
+	return w.close(w.n, w.WriteCloser.Close())
+}
+
+// Open implements FS.
+func (l *slogWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	start := time.Now()
+	f, err := l.fs.Open(ctx, path, options)
+	returned := time.Now()
+	duration := returned.Sub(start)
+	if err != nil {
+		l.log(ctx, OpOpen, path, duration, err)
+
+		return nil, err
+	}
+
+	f.ReadCloser = &countingReadCloser{
+		ReadCloser: f.ReadCloser,
+		close: func(n int64, err error) error {
+			l.log(ctx, OpOpen, path, duration, err, slog.Int64("bytes", n),
+				slog.Duration("transfer_duration", time.Since(returned)))
+
+			return err
+		},
+	}
+
+	return f, nil
+}
+
+// Attributes implements FS.
+func (l *slogWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	start := time.Now()
+	attrs, err := l.fs.Attributes(ctx, path, options)
+	l.log(ctx, OpAttributes, path, time.Since(start), err)
+
+	return attrs, err
+}
+
+// Create implements FS.
+func (l *slogWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	start := time.Now()
+	wc, err := l.fs.Create(ctx, path, options)
+	returned := time.Now()
+	duration := returned.Sub(start)
+	if err != nil {
+		l.log(ctx, OpCreate, path, duration, err)
+
+		return nil, err
+	}
+
+	return &countingWriteCloser{
+		WriteCloser: wc,
+		close: func(n int64, err error) error {
+			l.log(ctx, OpCreate, path, duration, err, slog.Int64("bytes", n),
+				slog.Duration("transfer_duration", time.Since(returned)))
+
+			return err
+		},
+	}, nil
+}
+
+// Delete implements FS.
+func (l *slogWrapper) Delete(ctx context.Context, path string) error {
+	start := time.Now()
+	err := l.fs.Delete(ctx, path)
+	l.log(ctx, OpDelete, path, time.Since(start), err)
+
+	return err
+}
+
+// Walk implements FS.
+func (l *slogWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	start := time.Now()
+	var entries int64
+	err := l.fs.Walk(ctx, path, func(path string) error {
+		entries++
+
+		return fn(path)
+	})
+	l.log(ctx, OpWalk, path, time.Since(start), err, slog.Int64("entries", entries))
+
+	return err
+}
+
+// URL implements FS.
+func (l *slogWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	start := time.Now()
+	url, err := l.fs.URL(ctx, path, options)
+	l.log(ctx, OpURL, path, time.Since(start), err)
+
+	return url, err
+}
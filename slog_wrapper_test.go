@@ -0,0 +1,101 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func newTestSlogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func parseLogs(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var logs []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var log map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &log))
+		logs = append(logs, log)
+	}
+	buf.Reset()
+
+	return logs
+}
+
+func TestSlogWrapper(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		var buf bytes.Buffer
+		fs := storage.NewSlogWrapper(mem, "mem", newTestSlogger(&buf), nil)
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+	})
+}
+
+func TestSlogWrapper_attributes(t *testing.T) {
+	ctx := storage.WithLogAttrs(context.Background(), slog.String("request_id", "42"))
+
+	withMem(func(mem storage.FS) {
+		var buf bytes.Buffer
+		fs := storage.NewSlogWrapper(mem, "mem", newTestSlogger(&buf), nil)
+
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), nil))
+		logs := parseLogs(t, &buf)
+		require.Len(t, logs, 1)
+		assert.Equal(t, "INFO", logs[0]["level"])
+		assert.Equal(t, "mem", logs[0]["fs"])
+		assert.Equal(t, "create", logs[0]["op"])
+		assert.Equal(t, "foo", logs[0]["path"])
+		assert.Equal(t, float64(3), logs[0]["bytes"])
+		assert.Equal(t, "42", logs[0]["request_id"])
+		assert.Contains(t, logs[0], "duration")
+		assert.Contains(t, logs[0], "transfer_duration")
+
+		_, err := storage.Read(ctx, fs, "foo", nil)
+		require.NoError(t, err)
+		logs = parseLogs(t, &buf)
+		require.Len(t, logs, 1)
+		assert.Equal(t, "open", logs[0]["op"])
+		assert.Equal(t, float64(3), logs[0]["bytes"])
+
+		_, err = storage.List(ctx, fs, "")
+		require.NoError(t, err)
+		logs = parseLogs(t, &buf)
+		require.Len(t, logs, 1)
+		assert.Equal(t, "walk", logs[0]["op"])
+		assert.Equal(t, float64(1), logs[0]["entries"])
+	})
+}
+
+func TestSlogWrapper_levels(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		var buf bytes.Buffer
+		fs := storage.NewSlogWrapper(mem, "mem", newTestSlogger(&buf), nil)
+
+		_, err := fs.Open(ctx, "foo", nil)
+		require.Error(t, err)
+		logs := parseLogs(t, &buf)
+		require.Len(t, logs, 1)
+		assert.Equal(t, "DEBUG", logs[0]["level"])
+		assert.Equal(t, "not_exist", logs[0]["error_class"])
+
+		_, err = fs.URL(ctx, "foo", nil)
+		require.Error(t, err)
+		logs = parseLogs(t, &buf)
+		require.Len(t, logs, 1)
+		assert.Equal(t, "ERROR", logs[0]["level"])
+		assert.Equal(t, "not_implemented", logs[0]["error_class"])
+	})
+}
@@ -9,10 +9,34 @@ import (
 // NewSlowWrapper creates an artificially slow FS.
 // Probably only useful for testing.
 func NewSlowWrapper(fs FS, readDelay time.Duration, writeDelay time.Duration) FS {
+	return NewSlowWrapperWithOptions(fs, &SlowOptions{
+		ReadDelay:  readDelay,
+		WriteDelay: writeDelay,
+	})
+}
+
+// SlowOptions are used to configure NewSlowWrapperWithOptions.
+type SlowOptions struct {
+	// ReadDelay is added to read operations: Open, Attributes, Walk, URL.
+	ReadDelay time.Duration
+	// WriteDelay is added to write operations: Create, Delete.
+	WriteDelay time.Duration
+
+	// Clock is used to wait for the delays.  Defaults to the system clock.
+	Clock Clock
+}
+
+// NewSlowWrapperWithOptions creates an artificially slow FS configured by options.
+func NewSlowWrapperWithOptions(fs FS, options *SlowOptions) FS {
+	if options == nil {
+		options = &SlowOptions{}
+	}
+
 	return &slowWrapper{
 		fs:         fs,
-		readDelay:  readDelay,
-		writeDelay: writeDelay,
+		readDelay:  options.ReadDelay,
+		writeDelay: options.WriteDelay,
+		clock:      clockOrDefault(options.Clock),
 	}
 }
 
@@ -20,58 +44,66 @@ type slowWrapper struct {
 	fs         FS
 	readDelay  time.Duration
 	writeDelay time.Duration
+	clock      Clock
 }
 
-func (fs *slowWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+// wait waits for delay, or until ctx is done.
+func (fs *slowWrapper) wait(ctx context.Context, delay time.Duration) error {
+	timer := fs.clock.NewTimer(delay)
+	defer timer.Stop()
+
 	select {
-	case <-time.After(fs.readDelay):
-		return fs.fs.Open(ctx, path, options)
+	case <-timer.C():
+		return nil
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return ctx.Err()
+	}
+}
+
+func (fs *slowWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	if err := fs.wait(ctx, fs.readDelay); err != nil {
+		return nil, err
 	}
+
+	return fs.fs.Open(ctx, path, options)
 }
 
 func (fs *slowWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
-	select {
-	case <-time.After(fs.readDelay):
-		return fs.fs.Walk(ctx, path, fn)
-	case <-ctx.Done():
-		return ctx.Err()
+	if err := fs.wait(ctx, fs.readDelay); err != nil {
+		return err
 	}
+
+	return fs.fs.Walk(ctx, path, fn)
 }
 
 func (fs *slowWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
-	select {
-	case <-time.After(fs.readDelay):
-		return fs.fs.Attributes(ctx, path, options)
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	if err := fs.wait(ctx, fs.readDelay); err != nil {
+		return nil, err
 	}
+
+	return fs.fs.Attributes(ctx, path, options)
 }
 
 func (fs *slowWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
-	select {
-	case <-time.After(fs.writeDelay):
-		return fs.fs.Create(ctx, path, options)
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	if err := fs.wait(ctx, fs.writeDelay); err != nil {
+		return nil, err
 	}
+
+	return fs.fs.Create(ctx, path, options)
 }
 
 func (fs *slowWrapper) Delete(ctx context.Context, path string) error {
-	select {
-	case <-time.After(fs.writeDelay):
-		return fs.fs.Delete(ctx, path)
-	case <-ctx.Done():
-		return ctx.Err()
+	if err := fs.wait(ctx, fs.writeDelay); err != nil {
+		return err
 	}
+
+	return fs.fs.Delete(ctx, path)
 }
 
 func (fs *slowWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
-	select {
-	case <-time.After(fs.readDelay):
-		return fs.fs.URL(ctx, path, options)
-	case <-ctx.Done():
-		return "", ctx.Err()
+	if err := fs.wait(ctx, fs.readDelay); err != nil {
+		return "", err
 	}
+
+	return fs.fs.URL(ctx, path, options)
 }
@@ -1,6 +1,7 @@
 package storage_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -25,3 +26,27 @@ func TestNewSlowWrapper(t *testing.T) {
 		assert.WithinDuration(t, start.Add(slowDelay*3), time.Now(), slowDelay)
 	})
 }
+
+func TestNewSlowWrapperWithOptions_Clock(t *testing.T) {
+	clock := testutils.NewFakeClock(time.Now())
+	fs := storage.NewSlowWrapperWithOptions(storage.NewMemoryFS(), &storage.SlowOptions{
+		ReadDelay: time.Hour,
+		Clock:     clock,
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := fs.Attributes(context.Background(), "foo", nil)
+		done <- err
+	}()
+
+	clock.WaitForTimers(1)
+	select {
+	case <-done:
+		t.Fatal("Attributes returned before the delay")
+	default:
+	}
+
+	clock.Advance(time.Hour)
+	assert.True(t, storage.IsNotExist(<-done))
+}
@@ -0,0 +1,58 @@
+package storage
+
+// NewSpyFS creates an FS backed by memory which records every call, with its arguments and the bytes written.
+// To be used in tests.
+func NewSpyFS() *SpyFS {
+	return &SpyFS{
+		RecordingWrapper: NewRecordingWrapper(NewMemoryFS()),
+	}
+}
+
+// SpyFS is an in-memory FS recording calls, see NewSpyFS.
+type SpyFS struct {
+	*RecordingWrapper
+}
+
+// Calls returns a snapshot of the calls to op recorded so far, in order, or all of them if op is empty.
+// It can be called concurrently with the calls to the FS.
+func (s *SpyFS) Calls(op Op) []Interaction {
+	var calls []Interaction
+	for _, i := range s.Interactions() {
+		if op == "" || i.Op == op {
+			calls = append(calls, i)
+		}
+	}
+
+	return calls
+}
+
+// CallsTo returns the calls to op on path recorded so far, in order.
+func (s *SpyFS) CallsTo(op Op, path string) []Interaction {
+	var calls []Interaction
+	for _, i := range s.Calls(op) {
+		if i.Path == path {
+			calls = append(calls, i)
+		}
+	}
+
+	return calls
+}
+
+// Written returns the bytes written by the last successful Create of path, and whether there was one.
+func (s *SpyFS) Written(path string) ([]byte, bool) {
+	calls := s.CallsTo(OpCreate, path)
+	for j := len(calls) - 1; j >= 0; j-- {
+		if i := calls[j]; i.Error == nil && i.CloseError == nil {
+			return i.Content, true
+		}
+	}
+
+	return nil, false
+}
+
+// Reset forgets the calls recorded so far, keeping the content of the FS, e.g. after setting it up.
+func (s *SpyFS) Reset() {
+	s.mu.Lock()
+	s.interactions = nil
+	s.mu.Unlock()
+}
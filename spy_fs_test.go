@@ -0,0 +1,44 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+)
+
+func TestSpyFS(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewSpyFS()
+
+	require.NoError(t, storage.Write(ctx, fs, "foo", []byte("setup"), nil))
+	fs.Reset()
+	assert.Empty(t, fs.Calls(""))
+
+	options := &storage.WriterOptions{Attributes: storage.Attributes{ContentType: "text/plain"}}
+	require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), options))
+	data, err := storage.Read(ctx, fs, "foo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(data))
+	_, err = fs.Attributes(ctx, "missing", nil)
+	assert.True(t, storage.IsNotExist(err))
+
+	assert.Len(t, fs.Calls(""), 3)
+	creates := fs.CallsTo(storage.OpCreate, "foo")
+	require.Len(t, creates, 1)
+	assert.Equal(t, "text/plain", creates[0].WriterOptions.Attributes.ContentType)
+	written, ok := fs.Written("foo")
+	assert.True(t, ok)
+	assert.Equal(t, "bar", string(written))
+
+	attrs := fs.Calls(storage.OpAttributes)
+	require.Len(t, attrs, 1)
+	assert.Equal(t, "missing", attrs[0].Path)
+	assert.Equal(t, "not_exist", attrs[0].Error.Class)
+
+	_, ok = fs.Written("missing")
+	assert.False(t, ok)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"expvar"
 	"io"
+	"time"
 )
 
 const (
@@ -17,96 +18,158 @@ const (
 	StatDeleteErrors = "delete.errors"
 	StatURLTotal     = "url.total"
 	StatURLErrors    = "url.errors"
+	StatWalkTotal    = "walk.total"
+	StatWalkErrors   = "walk.errors"
+
+	// StatOpenBytes and StatCreateBytes are the bytes read from Files returned by Open, and written to
+	// writers returned by Create.
+	StatOpenBytes   = "open.bytes"
+	StatCreateBytes = "create.bytes"
+	// StatWalkEntries is the number of paths walked.
+	StatWalkEntries = "walk.entries"
+
+	// Cumulative durations of the calls, in nanoseconds.
+	StatOpenDuration   = "open.duration_ns"
+	StatAttrsDuration  = "attrs.duration_ns"
+	StatCreateDuration = "create.duration_ns"
+	StatDeleteDuration = "delete.duration_ns"
+	StatURLDuration    = "url.duration_ns"
+	StatWalkDuration   = "walk.duration_ns"
 )
 
+var statNames = []string{
+	StatOpenTotal, StatOpenErrors, StatOpenBytes, StatOpenDuration,
+	StatAttrsTotal, StatAttrsErrors, StatAttrsDuration,
+	StatCreateTotal, StatCreateErrors, StatCreateBytes, StatCreateDuration,
+	StatDeleteTotal, StatDeleteErrors, StatDeleteDuration,
+	StatURLTotal, StatURLErrors, StatURLDuration,
+	StatWalkTotal, StatWalkErrors, StatWalkEntries, StatWalkDuration,
+}
+
 // NewStatsWrapper creates an FS which records accesses for an FS.
 // To retrieve the stats:
 // stats := expvar.Get(name).(*expvar.Map)
 // total := stats.Get("open.total").(*expvar.Int).Value() // int64
+//
+// The stats are published with expvar.NewMap, which panics if name is already used.
 func NewStatsWrapper(fs FS, name string) FS {
-	status := expvar.NewMap(name)
-	status.Set(StatOpenTotal, new(expvar.Int))
-	status.Set(StatOpenErrors, new(expvar.Int))
-
-	status.Set(StatAttrsTotal, new(expvar.Int))
-	status.Set(StatAttrsErrors, new(expvar.Int))
-
-	status.Set(StatCreateTotal, new(expvar.Int))
-	status.Set(StatCreateErrors, new(expvar.Int))
-
-	status.Set(StatDeleteTotal, new(expvar.Int))
-	status.Set(StatDeleteErrors, new(expvar.Int))
+	return NewStatsWrapperWithMap(fs, expvar.NewMap(name))
+}
 
-	status.Set(StatURLTotal, new(expvar.Int))
-	status.Set(StatURLErrors, new(expvar.Int))
+// NewStatsWrapperWithMap creates an FS which records accesses for an FS in stats, which may not be published
+// (e.g. new(expvar.Map).Init()), or be part of another published map.  Existing stats in the map are kept,
+// so several FS can share it.
+func NewStatsWrapperWithMap(fs FS, stats *expvar.Map) FS {
+	for _, name := range statNames {
+		if stats.Get(name) == nil {
+			stats.Set(name, new(expvar.Int))
+		}
+	}
 
 	return &statsWrapper{
 		fs:     fs,
-		status: status,
+		status: stats,
 	}
 }
 
+// NewUnpublishedStatsWrapper creates an FS which records accesses for an FS, and returns its stats without
+// publishing them.
+func NewUnpublishedStatsWrapper(fs FS) (FS, *expvar.Map) {
+	stats := new(expvar.Map).Init()
+
+	return NewStatsWrapperWithMap(fs, stats), stats
+}
+
 // statsWrapper is an FS which records accesses for an FS.
 type statsWrapper struct {
 	fs     FS
 	status *expvar.Map
 }
 
+// record records a call which started at start.
+func (s *statsWrapper) record(total, errors, duration string, start time.Time, err error) {
+	if err != nil {
+		s.status.Add(errors, 1)
+	}
+	s.status.Add(total, 1)
+	s.status.Add(duration, int64(time.Since(start)))
+}
+
 // Open implements FS.  All errors from Open are counted.
 func (s *statsWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	start := time.Now()
 	f, err := s.fs.Open(ctx, path, options)
+	s.record(StatOpenTotal, StatOpenErrors, StatOpenDuration, start, err)
 	if err != nil {
-		s.status.Add(StatOpenErrors, 1)
+		return nil, err
 	}
-	s.status.Add(StatOpenTotal, 1)
 
-	return f, err
+	f.ReadCloser = &countingReadCloser{
+		ReadCloser: f.ReadCloser,
+		close: func(n int64, err error) error {
+			s.status.Add(StatOpenBytes, n)
+
+			return err
+		},
+	}
+
+	return f, nil
 }
 
 // Attributes implements FS.  All errors from Attributes are counted.
 func (s *statsWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	start := time.Now()
 	a, err := s.fs.Attributes(ctx, path, options)
-	if err != nil {
-		s.status.Add(StatAttrsErrors, 1)
-	}
-	s.status.Add(StatAttrsTotal, 1)
+	s.record(StatAttrsTotal, StatAttrsErrors, StatAttrsDuration, start, err)
 
 	return a, err
 }
 
 // Create implements FS.  All errors from Create are counted.
 func (s *statsWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	start := time.Now()
 	wc, err := s.fs.Create(ctx, path, options)
+	s.record(StatCreateTotal, StatCreateErrors, StatCreateDuration, start, err)
 	if err != nil {
-		s.status.Add(StatCreateErrors, 1)
+		return nil, err
 	}
-	s.status.Add(StatCreateTotal, 1)
 
-	return wc, err
+	return &countingWriteCloser{
+		WriteCloser: wc,
+		close: func(n int64, err error) error {
+			s.status.Add(StatCreateBytes, n)
+
+			return err
+		},
+	}, nil
 }
 
 // Delete implements FS.  All errors from Delete are counted.
 func (s *statsWrapper) Delete(ctx context.Context, path string) error {
+	start := time.Now()
 	err := s.fs.Delete(ctx, path)
-	if err != nil {
-		s.status.Add(StatDeleteErrors, 1)
-	}
-	s.status.Add(StatDeleteTotal, 1)
+	s.record(StatDeleteTotal, StatDeleteErrors, StatDeleteDuration, start, err)
 
 	return err
 }
 
-// Walk implements FS.  No stats are recorded at this time.
+// Walk implements FS.  All errors from Walk are counted, along with the paths walked.
 func (s *statsWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
-	return s.fs.Walk(ctx, path, fn)
+	start := time.Now()
+	err := s.fs.Walk(ctx, path, func(path string) error {
+		s.status.Add(StatWalkEntries, 1)
+
+		return fn(path)
+	})
+	s.record(StatWalkTotal, StatWalkErrors, StatWalkDuration, start, err)
+
+	return err
 }
 
 func (s *statsWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	start := time.Now()
 	url, err := s.fs.URL(ctx, path, options)
-	if err != nil {
-		s.status.Add(StatURLErrors, 1)
-	}
-	s.status.Add(StatURLTotal, 1)
+	s.record(StatURLTotal, StatURLErrors, StatURLDuration, start, err)
 
 	return url, err
 }
@@ -1,12 +1,14 @@
 package storage_test
 
 import (
+	"context"
 	"crypto/sha1"
 	"expvar"
 	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/Shopify/go-storage"
 	"github.com/Shopify/go-storage/internal/testutils"
@@ -29,3 +31,43 @@ func TestNewStatsWrapper(t *testing.T) {
 		assert.Equal(t, int64(0), stats.Get(storage.StatDeleteErrors).(*expvar.Int).Value())
 	})
 }
+
+func TestNewUnpublishedStatsWrapper(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		// Wrappers can be created without conflicting names
+		fs, stats := storage.NewUnpublishedStatsWrapper(mem)
+		_, _ = storage.NewUnpublishedStatsWrapper(mem)
+
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), nil))
+		_, err := storage.Read(ctx, fs, "foo", nil)
+		require.NoError(t, err)
+		_, err = storage.List(ctx, fs, "")
+		require.NoError(t, err)
+
+		get := func(name string) int64 { return stats.Get(name).(*expvar.Int).Value() }
+		assert.Equal(t, int64(3), get(storage.StatCreateBytes))
+		assert.Equal(t, int64(3), get(storage.StatOpenBytes))
+		assert.Equal(t, int64(1), get(storage.StatWalkTotal))
+		assert.Equal(t, int64(1), get(storage.StatWalkEntries))
+		assert.Positive(t, get(storage.StatOpenDuration))
+	})
+}
+
+func TestNewStatsWrapperWithMap(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		stats := new(expvar.Map).Init()
+		fs := storage.NewStatsWrapperWithMap(mem, stats)
+		testutils.Delete(t, fs, "foo")
+
+		assert.Equal(t, int64(1), stats.Get(storage.StatDeleteTotal).(*expvar.Int).Value())
+		assert.Equal(t, int64(3), stats.Get(storage.StatCreateBytes).(*expvar.Int).Value())
+
+		// The counters are shared, not reset
+		fs = storage.NewStatsWrapperWithMap(mem, stats)
+		testutils.Delete(t, fs, "foo")
+		assert.Equal(t, int64(2), stats.Get(storage.StatDeleteTotal).(*expvar.Int).Value())
+		assert.Equal(t, int64(6), stats.Get(storage.StatCreateBytes).(*expvar.Int).Value())
+	})
+}
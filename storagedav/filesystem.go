@@ -0,0 +1,590 @@
+// Package storagedav adapts a storage.FS to a WebDAV file system, to be served by golang.org/x/net/webdav.
+package storagedav
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/Shopify/go-storage"
+)
+
+// DirMarker is the name of the empty objects created by Mkdir, so empty directories exist.  They are hidden
+// from directory listings.
+const DirMarker = ".keep"
+
+// errStop stops a Walk.
+var errStop = errors.New("stop")
+
+// NewFileSystem creates a webdav.FileSystem on top of fs.
+//
+// Directories are synthesized from the prefixes of the paths: a directory exists if a path starts with its
+// name followed by a "/".  Mkdir creates a DirMarker object in the directory.
+// Files opened for writing are written with Create, sequentially, and created when they are closed.
+// Rename copies the files, then deletes the originals.
+func NewFileSystem(fs storage.FS) webdav.FileSystem {
+	return &fileSystem{
+		fs: fs,
+	}
+}
+
+type fileSystem struct {
+	fs storage.FS
+}
+
+// storagePath returns the path in the FS of the WebDAV name, without leading and trailing slashes.
+func storagePath(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+func pathError(op, name string, err error) error {
+	if storage.IsNotExist(err) {
+		err = fs.ErrNotExist
+	}
+
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// walk calls fn with the paths under the directory dir ("" for the root).
+func (d *fileSystem) walk(ctx context.Context, dir string, fn func(path string) error) error {
+	prefix := dir
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	err := d.fs.Walk(ctx, prefix, func(path string) error {
+		// Local paths start with a "/"
+		path = strings.TrimPrefix(path, "/")
+		if !strings.HasPrefix(path, prefix) {
+			return nil
+		}
+
+		return fn(path)
+	})
+	if storage.IsNotExist(err) || errors.Is(err, fs.ErrNotExist) || isNotDir(err) {
+		return nil
+	}
+
+	return err
+}
+
+// isNotDir returns whether err is returned by walking a file as a directory.
+func isNotDir(err error) bool {
+	var pathErr *fs.PathError
+
+	return errors.As(err, &pathErr) && strings.Contains(pathErr.Err.Error(), "not a directory")
+}
+
+// isDir returns whether the directory p exists.
+func (d *fileSystem) isDir(ctx context.Context, p string) (bool, error) {
+	if p == "" {
+		return true, nil
+	}
+
+	found := false
+	err := d.walk(ctx, p, func(string) error {
+		found = true
+
+		return errStop
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return false, err
+	}
+
+	return found, nil
+}
+
+// stat returns the info of the file or directory p.
+func (d *fileSystem) stat(ctx context.Context, p string) (*fileInfo, error) {
+	isDir, err := d.isDir(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if isDir {
+		return &fileInfo{name: path.Base("/" + p), dir: true}, nil
+	}
+
+	attrs, err := d.fs.Attributes(ctx, p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileInfo{name: path.Base(p), attrs: attrs}, nil
+}
+
+// Stat implements webdav.FileSystem.
+func (d *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	fi, err := d.stat(ctx, storagePath(name))
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+
+	return fi, nil
+}
+
+// Mkdir implements webdav.FileSystem.
+func (d *fileSystem) Mkdir(ctx context.Context, name string, _ os.FileMode) error {
+	p := storagePath(name)
+	if _, err := d.stat(ctx, p); err == nil {
+		return pathError("mkdir", name, fs.ErrExist)
+	} else if !storage.IsNotExist(err) {
+		return pathError("mkdir", name, err)
+	}
+
+	parent := path.Dir("/" + p)
+	if isDir, err := d.isDir(ctx, storagePath(parent)); err != nil || !isDir {
+		if err == nil {
+			err = fs.ErrNotExist
+		}
+
+		return pathError("mkdir", name, err)
+	}
+
+	if err := storage.Write(ctx, d.fs, p+"/"+DirMarker, nil, nil); err != nil {
+		return pathError("mkdir", name, err)
+	}
+
+	return nil
+}
+
+// OpenFile implements webdav.FileSystem.  Files are opened for writing if flag has os.O_TRUNC, or
+// os.O_CREATE and they don't exist.  Otherwise, they are opened for reading.
+func (d *fileSystem) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	p := storagePath(name)
+	fi, err := d.stat(ctx, p)
+	if err != nil && !storage.IsNotExist(err) {
+		return nil, pathError("open", name, err)
+	}
+	exists := err == nil
+
+	switch {
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, pathError("open", name, fs.ErrExist)
+	case exists && fi.dir:
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return nil, pathError("open", name, errors.New("is a directory"))
+		}
+
+		return &dir{ctx: ctx, fs: d, path: p, info: fi}, nil
+	case flag&os.O_TRUNC != 0 || (!exists && flag&os.O_CREATE != 0):
+		if p == "" {
+			return nil, pathError("open", name, errors.New("is a directory"))
+		}
+		if isDir, err := d.isDir(ctx, storagePath(path.Dir("/"+p))); err != nil || !isDir {
+			if err == nil {
+				err = fs.ErrNotExist
+			}
+
+			return nil, pathError("open", name, err)
+		}
+
+		return newWriter(ctx, d.fs, p)
+	case !exists:
+		return nil, pathError("open", name, fs.ErrNotExist)
+	}
+
+	return &reader{ctx: ctx, fs: d.fs, path: p, info: fi}, nil
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (d *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	p := storagePath(name)
+
+	var paths []string
+	if err := d.walk(ctx, p, func(path string) error {
+		paths = append(paths, path)
+
+		return nil
+	}); err != nil {
+		return pathError("remove", name, err)
+	}
+	if p != "" {
+		paths = append(paths, p)
+	}
+
+	for _, path := range paths {
+		if err := d.fs.Delete(ctx, path); err != nil && !storage.IsNotExist(err) {
+			return pathError("remove", name, err)
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies the file src to dst, with its attributes.  dst is not written if the copy fails.
+func (d *fileSystem) copyFile(ctx context.Context, src, dst string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	f, err := d.fs.Open(ctx, src, &storage.ReaderOptions{ReadCompressed: true})
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	attrs := f.Attributes
+	attrs.ModTime, attrs.CreationTime, attrs.Size = time.Time{}, time.Time{}, 0
+	wc, err := d.fs.Create(ctx, dst, &storage.WriterOptions{Attributes: attrs})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(wc, f); err != nil {
+		storage.AbortWrite(cancel, wc)
+
+		return err
+	}
+
+	return wc.Close()
+}
+
+// Rename implements webdav.FileSystem, by copying then deleting the file or the files of the directory.
+func (d *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldPath, newPath := storagePath(oldName), storagePath(newName)
+	if oldPath == "" || newPath == "" || oldPath == newPath || strings.HasPrefix(newPath, oldPath+"/") {
+		return pathError("rename", oldName, fs.ErrInvalid)
+	}
+
+	fi, err := d.stat(ctx, oldPath)
+	if err != nil {
+		return pathError("rename", oldName, err)
+	}
+	if _, err := d.stat(ctx, newPath); err == nil {
+		return pathError("rename", newName, fs.ErrExist)
+	}
+
+	if !fi.dir {
+		if err := d.copyFile(ctx, oldPath, newPath); err != nil {
+			return pathError("rename", oldName, err)
+		}
+		if err := d.fs.Delete(ctx, oldPath); err != nil {
+			return pathError("rename", oldName, err)
+		}
+
+		return nil
+	}
+
+	var paths []string
+	if err := d.walk(ctx, oldPath, func(path string) error {
+		paths = append(paths, path)
+
+		return nil
+	}); err != nil {
+		return pathError("rename", oldName, err)
+	}
+	for _, path := range paths {
+		if err := d.copyFile(ctx, path, newPath+strings.TrimPrefix(path, oldPath)); err != nil {
+			return pathError("rename", oldName, err)
+		}
+	}
+	for _, path := range paths {
+		if err := d.fs.Delete(ctx, path); err != nil {
+			return pathError("rename", oldName, err)
+		}
+	}
+
+	return nil
+}
+
+// fileInfo is the os.FileInfo of a file, from its Attributes, or of a directory.
+type fileInfo struct {
+	name  string
+	dir   bool
+	attrs *storage.Attributes
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+func (fi *fileInfo) IsDir() bool  { return fi.dir }
+
+func (fi *fileInfo) Size() int64 {
+	if fi.dir {
+		return 0
+	}
+
+	return fi.attrs.Size
+}
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0o755
+	}
+
+	return 0o644
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	if fi.dir {
+		return time.Time{}
+	}
+
+	return fi.attrs.ModTime
+}
+
+// Sys returns the *storage.Attributes of files, nil for directories.
+func (fi *fileInfo) Sys() interface{} {
+	if fi.dir {
+		return nil
+	}
+
+	return fi.attrs
+}
+
+// ContentType implements webdav.ContentTyper, with the ContentType of files.
+func (fi *fileInfo) ContentType(context.Context) (string, error) {
+	if fi.dir || fi.attrs.ContentType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+
+	return fi.attrs.ContentType, nil
+}
+
+// ETag implements webdav.ETager, with the MD5 of files.
+func (fi *fileInfo) ETag(context.Context) (string, error) {
+	if fi.dir || len(fi.attrs.MD5) == 0 {
+		return "", webdav.ErrNotImplemented
+	}
+
+	return `"` + hex.EncodeToString(fi.attrs.MD5) + `"`, nil
+}
+
+// dir is a directory opened for reading its entries.
+type dir struct {
+	ctx     context.Context
+	fs      *fileSystem
+	path    string
+	info    *fileInfo
+	entries []os.FileInfo
+	read    bool
+}
+
+func (d *dir) Close() error                   { return nil }
+func (d *dir) Read([]byte) (int, error)       { return 0, errors.New("is a directory") }
+func (d *dir) Write([]byte) (int, error)      { return 0, errors.New("is a directory") }
+func (d *dir) Seek(int64, int) (int64, error) { return 0, errors.New("is a directory") }
+func (d *dir) Stat() (os.FileInfo, error)     { return d.info, nil }
+func (d *dir) list(ctx context.Context) error {
+	prefix := d.path
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	seen := map[string]bool{}
+	var files []string
+	err := d.fs.walk(ctx, d.path, func(path string) error {
+		name := strings.TrimPrefix(path, prefix)
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i]
+			if !seen[name] {
+				seen[name] = true
+				d.entries = append(d.entries, &fileInfo{name: name, dir: true})
+			}
+		} else if name != DirMarker {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		attrs, err := d.fs.fs.Attributes(ctx, file, nil)
+		if storage.IsNotExist(err) {
+			// Deleted since Walk
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		d.entries = append(d.entries, &fileInfo{name: path.Base(file), attrs: attrs})
+	}
+	sort.Slice(d.entries, func(i, j int) bool { return d.entries[i].Name() < d.entries[j].Name() })
+
+	return nil
+}
+
+// Readdir implements http.File.
+func (d *dir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.read {
+		d.read = true
+		if err := d.list(d.ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+
+	return entries, nil
+}
+
+// reader is a file opened for reading.  The content is opened on the first Read, and reopened after Seek.
+type reader struct {
+	ctx  context.Context
+	fs   storage.FS
+	path string
+	info *fileInfo
+
+	f      *storage.File
+	offset int64 // offset of the next Read
+}
+
+func (r *reader) Stat() (os.FileInfo, error) { return r.info, nil }
+
+func (r *reader) Readdir(int) ([]os.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
+
+func (r *reader) Write([]byte) (int, error) {
+	return 0, pathError("write", r.path, fs.ErrPermission)
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.f == nil {
+		f, err := r.fs.Open(r.ctx, r.path, nil)
+		if err != nil {
+			return 0, pathError("read", r.path, err)
+		}
+		r.f = f
+		if _, err := io.CopyN(io.Discard, f, r.offset); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Read(p)
+	r.offset += int64(n)
+
+	return n, err
+}
+
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.info.Size()
+	}
+	if offset < 0 {
+		return 0, pathError("seek", r.path, fs.ErrInvalid)
+	}
+
+	if offset != r.offset && r.f != nil {
+		err := r.f.Close()
+		r.f = nil
+		if err != nil {
+			return 0, err
+		}
+	}
+	r.offset = offset
+
+	return offset, nil
+}
+
+func (r *reader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+
+	return r.f.Close()
+}
+
+// writer is a file opened for writing, with Create.
+type writer struct {
+	path   string
+	wc     io.WriteCloser
+	cancel context.CancelFunc
+	size   int64
+	err    error
+}
+
+func newWriter(ctx context.Context, fs storage.FS, p string) (*writer, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	wc, err := fs.Create(ctx, p, nil)
+	if err != nil {
+		cancel()
+
+		return nil, pathError("open", "/"+p, err)
+	}
+
+	return &writer{path: p, wc: wc, cancel: cancel}, nil
+}
+
+func (w *writer) Stat() (os.FileInfo, error) {
+	return &fileInfo{name: path.Base(w.path), attrs: &storage.Attributes{Size: w.size, ModTime: time.Now()}}, nil
+}
+
+func (w *writer) Readdir(int) ([]os.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
+
+func (w *writer) Read([]byte) (int, error) {
+	return 0, pathError("read", w.path, fs.ErrPermission)
+}
+
+// Seek only supports querying the current position, as writes are sequential.
+func (w *writer) Seek(offset int64, whence int) (int64, error) {
+	if (whence == io.SeekCurrent && offset == 0) || (whence != io.SeekCurrent && offset == w.size) {
+		return w.size, nil
+	}
+
+	return 0, pathError("seek", w.path, errors.ErrUnsupported)
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.wc.Write(p)
+	w.size += int64(n)
+	if err != nil {
+		w.err = err
+	}
+
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom, so the failures to read the content, e.g. the body of PUT requests
+// copied by webdav.Handler, abort the file as well.
+func (w *writer) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(w.wc, r)
+	w.size += n
+	if err != nil {
+		w.err = err
+	}
+
+	return n, err
+}
+
+// Close creates the file, or aborts it if a Write or ReadFrom failed.
+func (w *writer) Close() error {
+	defer w.cancel()
+
+	if w.err != nil {
+		storage.AbortWrite(w.cancel, w.wc)
+
+		return w.err
+	}
+	if err := w.wc.Close(); err != nil {
+		return pathError("close", w.path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package storagedav_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+	"github.com/Shopify/go-storage/storagedav"
+)
+
+func serve(h http.Handler, method, path string, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func newHandler(fs storage.FS) http.Handler {
+	return &webdav.Handler{
+		FileSystem: storagedav.NewFileSystem(fs),
+		LockSystem: webdav.NewMemLS(),
+	}
+}
+
+func testHandler(t *testing.T, fs storage.FS) {
+	ctx := context.Background()
+	h := newHandler(fs)
+
+	rec := serve(h, "MKCOL", "/dir", "", nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(h, "MKCOL", "/dir", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	rec = serve(h, "MKCOL", "/missing/dir", "", nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = serve(h, http.MethodPut, "/dir/foo", "0123456789", nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(h, http.MethodPut, "/missing/foo", "bar", nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	data, err := storage.Read(ctx, fs, "dir/foo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+
+	rec = serve(h, http.MethodGet, "/dir/foo", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0123456789", rec.Body.String())
+
+	rec = serve(h, http.MethodGet, "/dir/foo", "", http.Header{"Range": {"bytes=2-4"}})
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "234", rec.Body.String())
+
+	rec = serve(h, "PROPFIND", "/dir", "", http.Header{"Depth": {"1"}})
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<D:href>/dir/foo</D:href>")
+	assert.Contains(t, rec.Body.String(), "<D:getcontentlength>10</D:getcontentlength>")
+	assert.NotContains(t, rec.Body.String(), storagedav.DirMarker)
+
+	rec = serve(h, "MOVE", "/dir", "", http.Header{"Destination": {"/moved"}})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(h, http.MethodGet, "/moved/foo", "", nil)
+	assert.Equal(t, "0123456789", rec.Body.String())
+	rec = serve(h, http.MethodGet, "/dir/foo", "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(h, "MOVE", "/moved/foo", "", http.Header{"Destination": {"/bar"}})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	data, err = storage.Read(ctx, fs, "bar", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+
+	rec = serve(h, http.MethodDelete, "/moved", "", nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = serve(h, "PROPFIND", "/moved", "", http.Header{"Depth": {"0"}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestFileSystem_Handler(t *testing.T) {
+	testHandler(t, storage.NewMemoryFS())
+}
+
+func TestFileSystem_HandlerLocal(t *testing.T) {
+	testHandler(t, storage.NewLocalFS(t.TempDir()))
+}
+
+func TestFileSystem_Stat(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewMemoryFS()
+	require.NoError(t, storage.Write(ctx, fs, "a/b/c", []byte("c"), nil))
+	require.NoError(t, storage.Write(ctx, fs, "a/d", []byte("dd"), &storage.WriterOptions{
+		Attributes: storage.Attributes{ContentType: "text/plain"},
+	}))
+	dav := storagedav.NewFileSystem(fs)
+
+	fi, err := dav.Stat(ctx, "/a/b")
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+	assert.Equal(t, "b", fi.Name())
+
+	fi, err = dav.Stat(ctx, "/a/d")
+	require.NoError(t, err)
+	assert.False(t, fi.IsDir())
+	assert.Equal(t, int64(2), fi.Size())
+	assert.IsType(t, &storage.Attributes{}, fi.Sys())
+	contentType, err := fi.(webdav.ContentTyper).ContentType(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", contentType)
+
+	_, err = dav.Stat(ctx, "/a/missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	f, err := dav.OpenFile(ctx, "/a", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	entries, err := f.Readdir(1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "b", entries[0].Name())
+	assert.True(t, entries[0].IsDir())
+	entries, err = f.Readdir(1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "d", entries[0].Name())
+	_, err = f.Readdir(1)
+	assert.ErrorIs(t, err, io.EOF)
+	require.NoError(t, f.Close())
+
+	_, err = dav.OpenFile(ctx, "/a/d", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	assert.ErrorIs(t, err, os.ErrExist)
+}
+
+var errReadFailed = errors.New("read failed")
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errReadFailed
+}
+
+// failingFS fails reading the content of the files it opens, and walks with the context.
+type failingFS struct {
+	storage.FS
+}
+
+func (f *failingFS) Open(ctx context.Context, path string, options *storage.ReaderOptions) (*storage.File, error) {
+	file, err := f.FS.Open(ctx, path, options)
+	if err != nil {
+		return nil, err
+	}
+	_ = file.Close()
+	file.ReadCloser = io.NopCloser(failingReader{})
+
+	return file, nil
+}
+
+func (f *failingFS) Walk(ctx context.Context, path string, fn storage.WalkFn) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return f.FS.Walk(ctx, path, fn)
+}
+
+func TestFileSystem_FailedWrites(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemoryFS()
+	testutils.Create(t, mem, "foo", "bar")
+	dav := storagedav.NewFileSystem(&failingFS{FS: mem})
+
+	// A failed read of the content, e.g. of the body of a PUT, doesn't write the file
+	f, err := dav.OpenFile(ctx, "/baz", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	require.NoError(t, err)
+	_, err = io.Copy(f, io.MultiReader(strings.NewReader("partial"), failingReader{}))
+	require.ErrorIs(t, err, errReadFailed)
+	assert.ErrorIs(t, f.Close(), errReadFailed)
+	testutils.OpenNotExists(t, mem, "baz")
+
+	// A failed copy doesn't write the destination, nor delete the source
+	err = dav.Rename(ctx, "/foo", "/qux")
+	assert.ErrorIs(t, err, errReadFailed)
+	testutils.OpenNotExists(t, mem, "qux")
+	testutils.OpenExists(t, mem, "foo", "bar")
+}
+
+func TestFileSystem_ReaddirContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mem := storage.NewMemoryFS()
+	testutils.Create(t, mem, "a/b", "b")
+	dav := storagedav.NewFileSystem(&failingFS{FS: mem})
+
+	f, err := dav.OpenFile(ctx, "/a", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	cancel()
+	_, err = f.Readdir(0)
+	assert.ErrorIs(t, err, context.Canceled)
+}
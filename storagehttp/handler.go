@@ -0,0 +1,313 @@
+// Package storagehttp serves the objects of a storage.FS over HTTP.
+package storagehttp
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/httprange"
+)
+
+// Options are used to configure Handler.
+type Options struct {
+	// Scope is the scope of the requests allowed: storage.ScopeRead for GET and HEAD, storage.ScopeWrite
+	// for PUT and storage.ScopeDelete for DELETE.  Defaults to storage.ScopeRead.
+	Scope storage.Scope
+}
+
+// Listing is the JSON response to GET requests on directories, i.e. on paths ending with "/".
+type Listing struct {
+	Path    string         `json:"path"`
+	Entries []ListingEntry `json:"entries"`
+}
+
+// ListingEntry is a file or a subdirectory of a Listing.
+type ListingEntry struct {
+	// Name is the name of the entry in the directory, ending with "/" for subdirectories.
+	Name string `json:"name"`
+	Dir  bool   `json:"dir,omitempty"`
+}
+
+// Handler creates an http.Handler serving the objects of fs at their path, e.g. with http.StripPrefix:
+//   - GET serves objects, with their Content-Type.  Single byte ranges and the If-None-Match (with the MD5
+//     of objects as ETag) and If-Modified-Since conditional headers are supported.  Objects with a
+//     Content-Encoding are served as stored, with their Content-Encoding, as not all FS can decompress them.
+//   - GET on paths ending with "/" lists the directory as a JSON Listing, from Walk.
+//   - HEAD serves the headers of objects, from Attributes.
+//   - PUT creates objects, with the Content-Type and Content-Encoding of the request.
+//   - DELETE deletes objects.
+//
+// Methods outside options.Scope are not allowed.  The paths of the requests are cleaned, so they can't
+// escape the root of the FS, e.g. of a localFS.
+func Handler(fs storage.FS, options *Options) http.Handler {
+	if options == nil {
+		options = &Options{}
+	}
+	scope := options.Scope
+	if scope == 0 {
+		scope = storage.ScopeRead
+	}
+
+	return &handler{
+		fs:    fs,
+		scope: scope,
+	}
+}
+
+type handler struct {
+	fs    storage.FS
+	scope storage.Scope
+}
+
+// methodScopes are the scopes required by the methods.
+var methodScopes = map[string]storage.Scope{
+	http.MethodGet:    storage.ScopeRead,
+	http.MethodHead:   storage.ScopeRead,
+	http.MethodPut:    storage.ScopeWrite,
+	http.MethodDelete: storage.ScopeDelete,
+}
+
+// allowed returns the methods allowed by the scope of h.
+func (h *handler) allowed() string {
+	var methods []string
+	for method, scope := range methodScopes {
+		if h.scope.Has(scope) {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+
+	return strings.Join(methods, ", ")
+}
+
+// ServeHTTP implements http.Handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	scope, ok := methodScopes[r.Method]
+	if !ok || !h.scope.Has(scope) {
+		w.Header().Set("Allow", h.allowed())
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	path := objectPath(r.URL.Path)
+	isDir := path == "" || strings.HasSuffix(path, "/")
+
+	switch {
+	case r.Method == http.MethodGet && isDir:
+		h.list(w, r, path)
+	case isDir:
+		http.Error(w, "not an object", http.StatusBadRequest)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		h.get(w, r, path)
+	case r.Method == http.MethodPut:
+		h.put(w, r, path)
+	case r.Method == http.MethodDelete:
+		if err := h.fs.Delete(r.Context(), path); err != nil {
+			writeError(w, err)
+
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// objectPath returns the path in the FS of the URL path p, cleaned so ".." segments can't escape the root
+// of the FS, without leading slash.  The trailing slash of directories is kept.
+func objectPath(p string) string {
+	cleaned := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if cleaned != "" && strings.HasSuffix(p, "/") {
+		cleaned += "/"
+	}
+
+	return cleaned
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), storage.HTTPStatus(err))
+}
+
+// list serves the entries of the directory dir.
+func (h *handler) list(w http.ResponseWriter, r *http.Request, dir string) {
+	seen := map[string]bool{}
+	listing := &Listing{Path: dir, Entries: []ListingEntry{}}
+	err := h.fs.Walk(r.Context(), dir, func(path string) error {
+		// Local paths start with a "/"
+		path = strings.TrimPrefix(path, "/")
+		if !strings.HasPrefix(path, dir) {
+			return nil
+		}
+
+		name := strings.TrimPrefix(path, dir)
+		entry := ListingEntry{Name: name}
+		if i := strings.Index(name, "/"); i >= 0 {
+			entry = ListingEntry{Name: name[:i+1], Dir: true}
+		}
+		if !seen[entry.Name] {
+			seen[entry.Name] = true
+			listing.Entries = append(listing.Entries, entry)
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		writeError(w, err)
+
+		return
+	}
+	if len(listing.Entries) == 0 && dir != "" {
+		http.Error(w, fmt.Sprintf("storage %v: path does not exist", dir), http.StatusNotFound)
+
+		return
+	}
+	sort.Slice(listing.Entries, func(i, j int) bool { return listing.Entries[i].Name < listing.Entries[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(listing)
+}
+
+// notModified returns whether the conditional headers of r match attrs.
+func notModified(r *http.Request, etag string, attrs *storage.Attributes) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, v := range strings.Split(inm, ",") {
+			v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+			if v == etag || v == "*" {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !attrs.ModTime.IsZero() {
+		t, err := http.ParseTime(ims)
+
+		return err == nil && !attrs.ModTime.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
+
+// get serves the object at path, or its headers for HEAD requests.
+func (h *handler) get(w http.ResponseWriter, r *http.Request, path string) {
+	ctx := r.Context()
+	attrs, err := h.fs.Attributes(ctx, path, &storage.ReaderOptions{ReadCompressed: true})
+	if err != nil {
+		writeError(w, err)
+
+		return
+	}
+
+	// The content is served as stored, so its size is known and ranges can be served
+	header := w.Header()
+	if attrs.ContentType != "" {
+		header.Set("Content-Type", attrs.ContentType)
+	}
+	if attrs.ContentEncoding != "" {
+		header.Set("Content-Encoding", attrs.ContentEncoding)
+	}
+	if !attrs.ModTime.IsZero() {
+		header.Set("Last-Modified", attrs.ModTime.UTC().Format(http.TimeFormat))
+	}
+	var etag string
+	if len(attrs.MD5) > 0 {
+		etag = `"` + hex.EncodeToString(attrs.MD5) + `"`
+		header.Set("ETag", etag)
+	}
+	header.Set("Accept-Ranges", "bytes")
+
+	if notModified(r, etag, attrs) {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	start, length, ranged := int64(0), attrs.Size, false
+	if rh := r.Header.Get("Range"); rh != "" {
+		if ifRange := r.Header.Get("If-Range"); ifRange == "" || (etag != "" && ifRange == etag) {
+			start, length, ranged, err = httprange.Parse(rh, attrs.Size)
+			if err != nil {
+				header.Set("Content-Range", fmt.Sprintf("bytes */%d", attrs.Size))
+				http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+
+				return
+			}
+			if !ranged {
+				length = attrs.Size
+			}
+		}
+	}
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	f, err := h.fs.Open(ctx, path, &storage.ReaderOptions{ReadCompressed: true})
+	if err != nil {
+		header.Del("Content-Length")
+		writeError(w, err)
+
+		return
+	}
+	defer f.Close()
+
+	var body io.Reader = f
+	if ranged {
+		if _, err := io.CopyN(io.Discard, f, start); err != nil {
+			header.Del("Content-Length")
+			writeError(w, err)
+
+			return
+		}
+		body = io.LimitReader(f, length)
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, attrs.Size))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	_, _ = io.Copy(w, body)
+}
+
+// put creates the object at path with the body of r.
+func (h *handler) put(w http.ResponseWriter, r *http.Request, path string) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	wc, err := h.fs.Create(ctx, path, &storage.WriterOptions{
+		Attributes: storage.Attributes{
+			ContentType:     r.Header.Get("Content-Type"),
+			ContentEncoding: r.Header.Get("Content-Encoding"),
+		},
+	})
+	if err != nil {
+		writeError(w, err)
+
+		return
+	}
+	if _, err := io.Copy(wc, r.Body); err != nil {
+		storage.AbortWrite(cancel, wc)
+		writeError(w, err)
+
+		return
+	}
+	if err := wc.Close(); err != nil {
+		writeError(w, err)
+
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
@@ -0,0 +1,199 @@
+package storagehttp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/storagehttp"
+)
+
+func serve(h http.Handler, method, path string, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestHandler_Get(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewMemoryFS()
+	require.NoError(t, storage.Write(ctx, fs, "foo", []byte("0123456789"), &storage.WriterOptions{
+		Attributes: storage.Attributes{ContentType: "text/plain"},
+	}))
+	h := storagehttp.Handler(fs, nil)
+
+	rec := serve(h, http.MethodGet, "/foo", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0123456789", rec.Body.String())
+	assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "10", rec.Header().Get("Content-Length"))
+	etag := rec.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	rec = serve(h, http.MethodHead, "/foo", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, "10", rec.Header().Get("Content-Length"))
+
+	rec = serve(h, http.MethodGet, "/foo", "", http.Header{"Range": {"bytes=2-4"}})
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "234", rec.Body.String())
+	assert.Equal(t, "bytes 2-4/10", rec.Header().Get("Content-Range"))
+
+	rec = serve(h, http.MethodGet, "/foo", "", http.Header{"Range": {"bytes=-3"}})
+	assert.Equal(t, "789", rec.Body.String())
+
+	rec = serve(h, http.MethodGet, "/foo", "", http.Header{"Range": {"bytes=20-"}})
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rec.Code)
+
+	rec = serve(h, http.MethodGet, "/foo", "", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	lastModified := rec.Header().Get("Last-Modified")
+	rec = serve(h, http.MethodGet, "/foo", "", http.Header{"If-Modified-Since": {lastModified}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	rec = serve(h, http.MethodGet, "/missing", "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandler_ContentEncoding(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewCompressionWrapper(storage.NewMemoryFS(), &storage.CompressionOptions{
+		Rules: []storage.CompressionRule{{Encoding: storage.ContentEncodingGzip}},
+	})
+	require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), nil))
+	h := storagehttp.Handler(fs, nil)
+
+	rec := serve(h, http.MethodGet, "/foo", "", http.Header{"Accept-Encoding": {"gzip, deflate"}})
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	r, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(r)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", buf.String())
+
+	// Served as stored even if the client doesn't accept the encoding, as not all FS can decompress it
+	rec = serve(h, http.MethodGet, "/foo", "", nil)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err = zw.Write([]byte("baz"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	h = storagehttp.Handler(storage.NewMemoryFS(), &storagehttp.Options{Scope: storage.ScopeRW})
+	rec = serve(h, http.MethodPut, "/baz", gz.String(), http.Header{"Content-Encoding": {"gzip"}})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(h, http.MethodGet, "/baz", "", nil)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, gz.Bytes(), rec.Body.Bytes())
+}
+
+func TestHandler_traversal(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0o600))
+	fs := storage.NewLocalFS(filepath.Join(dir, "root"))
+	require.NoError(t, storage.Write(context.Background(), fs, "foo", []byte("bar"), nil))
+	h := storagehttp.Handler(fs, &storagehttp.Options{Scope: storage.ScopeRWD})
+
+	for _, path := range []string{"/../secret", "/foo/../../secret", "/./../secret"} {
+		rec := serve(h, http.MethodGet, path, "", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+		rec = serve(h, http.MethodDelete, path, "", nil)
+		assert.Equal(t, http.StatusNoContent, rec.Code, path)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "secret"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(data))
+
+	// Cleaned paths are served
+	rec := serve(h, http.MethodGet, "/bar/../foo", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "bar", rec.Body.String())
+}
+
+func TestHandler_List(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewMemoryFS()
+	for _, path := range []string{"a/b", "a/c/d", "a/c/e", "f"} {
+		require.NoError(t, storage.Write(ctx, fs, path, []byte(path), nil))
+	}
+	h := storagehttp.Handler(fs, nil)
+
+	rec := serve(h, http.MethodGet, "/a/", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var listing storagehttp.Listing
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listing))
+	assert.Equal(t, storagehttp.Listing{
+		Path: "a/",
+		Entries: []storagehttp.ListingEntry{
+			{Name: "b"},
+			{Name: "c/", Dir: true},
+		},
+	}, listing)
+
+	rec = serve(h, http.MethodGet, "/missing/", "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandler_Scope(t *testing.T) {
+	fs := storage.NewMemoryFS()
+
+	h := storagehttp.Handler(fs, nil)
+	rec := serve(h, http.MethodPut, "/foo", "bar", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, HEAD", rec.Header().Get("Allow"))
+
+	h = storagehttp.Handler(fs, &storagehttp.Options{Scope: storage.ScopeRWD})
+	rec = serve(h, http.MethodPut, "/foo", "bar", http.Header{"Content-Type": {"text/plain"}})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	attrs, err := fs.Attributes(context.Background(), "foo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", attrs.ContentType)
+
+	rec = serve(h, http.MethodDelete, "/foo", "", nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	_, err = fs.Attributes(context.Background(), "foo", nil)
+	assert.True(t, storage.IsNotExist(err))
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestHandler_PutFailedBody(t *testing.T) {
+	fs := storage.NewMemoryFS()
+	h := storagehttp.Handler(fs, &storagehttp.Options{Scope: storage.ScopeWrite})
+
+	req := httptest.NewRequest(http.MethodPut, "/foo", io.MultiReader(strings.NewReader("partial"), failingReader{}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	// The truncated body isn't written
+	_, err := fs.Attributes(context.Background(), "foo", nil)
+	assert.True(t, storage.IsNotExist(err))
+}
@@ -0,0 +1,265 @@
+package storages3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	amzDateLayout   = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	maxClockSkew    = 15 * time.Minute
+	// maxPresignedExpiry is the maximum X-Amz-Expires of presigned URLs, 7 days.
+	maxPresignedExpiry = 604800
+)
+
+// sigV4Request holds the signature parameters of a request, from its Authorization header or its query
+// (presigned URLs).
+type sigV4Request struct {
+	accessKey     string
+	date          string // yyyymmdd
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	amzDate       time.Time
+	payloadHash   string
+	presigned     bool
+}
+
+// parseCredential parses a credential "<key>/<date>/<region>/<service>/aws4_request".
+func (s *sigV4Request) parseCredential(credential string) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return errAuthorizationMalformed
+	}
+	s.accessKey, s.date, s.region, s.service = parts[0], parts[1], parts[2], parts[3]
+
+	return nil
+}
+
+// parseSigV4 parses the signature parameters of r.  It returns nil if r is not signed.
+func parseSigV4(r *http.Request) (*sigV4Request, error) {
+	s := &sigV4Request{}
+	var amzDate string
+
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		params, found := strings.CutPrefix(auth, sigV4Algorithm+" ")
+		if !found {
+			return nil, errAuthorizationMalformed
+		}
+		for _, param := range strings.Split(params, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch k {
+			case "Credential":
+				if err := s.parseCredential(v); err != nil {
+					return nil, err
+				}
+			case "SignedHeaders":
+				s.signedHeaders = strings.Split(v, ";")
+			case "Signature":
+				s.signature = v
+			}
+		}
+		amzDate = r.Header.Get("X-Amz-Date")
+		s.payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+		if s.payloadHash == "" {
+			return nil, errAuthorizationMalformed
+		}
+	} else {
+		q := r.URL.Query()
+		if q.Get("X-Amz-Algorithm") == "" {
+			return nil, nil
+		}
+		if q.Get("X-Amz-Algorithm") != sigV4Algorithm {
+			return nil, errAuthorizationMalformed
+		}
+		if err := s.parseCredential(q.Get("X-Amz-Credential")); err != nil {
+			return nil, err
+		}
+		s.signedHeaders = strings.Split(q.Get("X-Amz-SignedHeaders"), ";")
+		s.signature = q.Get("X-Amz-Signature")
+		amzDate = q.Get("X-Amz-Date")
+		s.payloadHash = unsignedPayload
+		s.presigned = true
+	}
+
+	// The host must be signed, so the signature can't be replayed against another endpoint
+	if s.accessKey == "" || s.signature == "" || !slices.Contains(s.signedHeaders, "host") {
+		return nil, errAuthorizationMalformed
+	}
+	var err error
+	if s.amzDate, err = time.Parse(amzDateLayout, amzDate); err != nil {
+		return nil, errAuthorizationMalformed
+	}
+
+	return s, nil
+}
+
+// awsEscape escapes s as required by SigV4: all bytes but the unreserved characters are escaped, and
+// slashes if escapeSlash is set.
+func awsEscape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// canonicalRequest returns the canonical request of r signed by s.
+func (s *sigV4Request) canonicalRequest(r *http.Request) string {
+	query := r.URL.Query()
+	query.Del("X-Amz-Signature")
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+
+	var headers strings.Builder
+	for _, name := range s.signedHeaders {
+		var values []string
+		if name == "host" {
+			values = []string{r.Host}
+		} else {
+			values = r.Header.Values(name)
+		}
+		for i, v := range values {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		awsEscape(r.URL.Path, false),
+		strings.Join(params, "&"),
+		headers.String(),
+		strings.Join(s.signedHeaders, ";"),
+		s.payloadHash,
+	}, "\n")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// expectedSignature returns the signature of r with secret.
+func (s *sigV4Request) expectedSignature(r *http.Request, secret string) string {
+	canonical := sha256.Sum256([]byte(s.canonicalRequest(r)))
+	scope := strings.Join([]string{s.date, s.region, s.service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		s.amzDate.Format(amzDateLayout),
+		scope,
+		hex.EncodeToString(canonical[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secret), s.date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// authenticate verifies the SigV4 signature of r, and wraps its body to verify its SHA-256 if signed.
+func (h *handler) authenticate(r *http.Request) error {
+	if len(h.options.Credentials) == 0 {
+		return nil
+	}
+
+	s, err := parseSigV4(r)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return errAccessDenied
+	}
+
+	secret, ok := h.options.Credentials[s.accessKey]
+	if !ok {
+		return errInvalidAccessKeyID
+	}
+	if s.region != h.options.Region || s.service != "s3" || s.date != s.amzDate.Format("20060102") {
+		return errAuthorizationMalformed
+	}
+
+	now := h.now()
+	if s.presigned {
+		expires, err := strconv.Atoi(r.URL.Query().Get("X-Amz-Expires"))
+		if err != nil || expires <= 0 || expires > maxPresignedExpiry {
+			return errAuthorizationQuery
+		}
+		if now.Before(s.amzDate.Add(-maxClockSkew)) || !now.Before(s.amzDate.Add(time.Duration(expires)*time.Second)) {
+			return errExpiredRequest
+		}
+	} else if d := now.Sub(s.amzDate); d > maxClockSkew || d < -maxClockSkew {
+		return errRequestTimeTooSkewed
+	}
+
+	if !hmac.Equal([]byte(s.expectedSignature(r, secret)), []byte(s.signature)) {
+		return errSignatureDoesNotMatch
+	}
+
+	switch {
+	case s.payloadHash == unsignedPayload:
+	case strings.HasPrefix(s.payloadHash, "STREAMING-"):
+		return errNotImplemented
+	default:
+		want, err := hex.DecodeString(s.payloadHash)
+		if err != nil || len(want) != sha256.Size {
+			return errInvalidDigest
+		}
+		r.Body = &hashingReadCloser{ReadCloser: r.Body, h: sha256.New(), want: want}
+	}
+
+	return nil
+}
+
+// hashingReadCloser returns errContentSHA256Mismatch at EOF if the hash of the content read isn't want.
+type hashingReadCloser struct {
+	io.ReadCloser
+	h    hash.Hash
+	want []byte
+}
+
+func (r *hashingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.h.Write(p[:n])
+	if err == io.EOF && !hmac.Equal(r.h.Sum(nil), r.want) { //nolint:errorlint // io.EOF is never wrapped by Read.
+		return n, errContentSHA256Mismatch
+	}
+
+	return n, err
+}
@@ -0,0 +1,98 @@
+package storages3
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+
+	"github.com/Shopify/go-storage"
+)
+
+// s3Error is an error of the S3 API.
+type s3Error struct {
+	Code    string
+	Message string
+	Status  int
+}
+
+// Error implements error
+func (e *s3Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errAccessDenied           = &s3Error{"AccessDenied", "Access Denied", http.StatusForbidden}
+	errAuthorizationMalformed = &s3Error{"AuthorizationHeaderMalformed", "The authorization is malformed", http.StatusBadRequest}
+	errAuthorizationQuery     = &s3Error{"AuthorizationQueryParametersError", "X-Amz-Expires must be between 1 and 604800 seconds", http.StatusBadRequest}
+	errBadDigest              = &s3Error{"BadDigest", "The Content-MD5 you specified did not match what we received", http.StatusBadRequest}
+	errContentSHA256Mismatch  = &s3Error{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed", http.StatusBadRequest}
+	errExpiredRequest         = &s3Error{"AccessDenied", "Request has expired", http.StatusForbidden}
+	errInternal               = &s3Error{"InternalError", "We encountered an internal error, please try again", http.StatusInternalServerError}
+	errInvalidAccessKeyID     = &s3Error{"InvalidAccessKeyId", "The access key ID you provided does not exist in our records", http.StatusForbidden}
+	errInvalidArgument        = &s3Error{"InvalidArgument", "Invalid argument", http.StatusBadRequest}
+	errInvalidDigest          = &s3Error{"InvalidDigest", "The digest you specified is not valid", http.StatusBadRequest}
+	errInvalidPart            = &s3Error{"InvalidPart", "One or more of the specified parts could not be found", http.StatusBadRequest}
+	errInvalidPartOrder       = &s3Error{"InvalidPartOrder", "The list of parts was not in ascending order", http.StatusBadRequest}
+	errInvalidRange           = &s3Error{"InvalidRange", "The requested range is not satisfiable", http.StatusRequestedRangeNotSatisfiable}
+	errMalformedXML           = &s3Error{"MalformedXML", "The XML you provided was not well-formed", http.StatusBadRequest}
+	errMethodNotAllowed       = &s3Error{"MethodNotAllowed", "The specified method is not allowed against this resource", http.StatusMethodNotAllowed}
+	errNoSuchBucket           = &s3Error{"NoSuchBucket", "The specified bucket does not exist", http.StatusNotFound}
+	errNoSuchKey              = &s3Error{"NoSuchKey", "The specified key does not exist", http.StatusNotFound}
+	errNoSuchUpload           = &s3Error{"NoSuchUpload", "The specified upload does not exist", http.StatusNotFound}
+	errNotImplemented         = &s3Error{"NotImplemented", "A header or query you provided implies functionality that is not implemented", http.StatusNotImplemented}
+	errPreconditionFailed     = &s3Error{"PreconditionFailed", "At least one of the preconditions you specified did not hold", http.StatusPreconditionFailed}
+	errRequestTimeTooSkewed   = &s3Error{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large", http.StatusForbidden}
+	errSignatureDoesNotMatch  = &s3Error{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided", http.StatusForbidden}
+)
+
+// toS3Error returns the S3 error of err.
+func toS3Error(err error) *s3Error {
+	var s3Err *s3Error
+	switch {
+	case errors.As(err, &s3Err):
+		return s3Err
+	case storage.IsNotExist(err):
+		return errNoSuchKey
+	case storage.IsExist(err):
+		return errPreconditionFailed
+	case errors.Is(err, storage.ErrChecksumMismatch):
+		return errBadDigest
+	case errors.Is(err, storage.ErrPermissionDenied), errors.Is(err, storage.ErrObjectLocked):
+		return errAccessDenied
+	case errors.Is(err, storage.ErrNotImplemented):
+		return errNotImplemented
+	}
+
+	return errInternal
+}
+
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+// writeError writes the S3 error of err.  The body is omitted for HEAD requests.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	s3Err := toS3Error(err)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(s3Err.Status)
+
+		return
+	}
+
+	writeXML(w, s3Err.Status, &errorResponse{
+		Code:     s3Err.Code,
+		Message:  s3Err.Message,
+		Resource: r.URL.Path,
+	})
+}
+
+// writeXML writes v as the XML body of the response.
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(v)
+}
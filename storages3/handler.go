@@ -0,0 +1,584 @@
+// Package storages3 implements the core of the Amazon S3 REST API on top of a storage.FS, so any FS can be
+// used by S3 clients.
+package storages3
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec // MD5 is the ETag of S3 objects.
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/httprange"
+)
+
+const (
+	// DefaultBucket is the default name of the bucket served.
+	DefaultBucket = "storage"
+	// DefaultRegion is the default region of the signatures.
+	DefaultRegion = "us-east-1"
+	// DefaultUploadsPrefix is the default prefix of the parts of multipart uploads in the FS.
+	DefaultUploadsPrefix = ".uploads/"
+	// DefaultUploadExpiry is the default duration after which incomplete multipart uploads are deleted.
+	DefaultUploadExpiry = 24 * time.Hour
+
+	s3Namespace     = "http://s3.amazonaws.com/doc/2006-03-01/"
+	metadataPrefix  = "X-Amz-Meta-"
+	lastModifiedFmt = "2006-01-02T15:04:05.000Z"
+	maxKeys         = 1000
+)
+
+// Options are used to configure Handler.
+type Options struct {
+	// Bucket is the name of the single bucket served.  Defaults to DefaultBucket.
+	Bucket string
+	// Region is the region of the SigV4 signatures.  Defaults to DefaultRegion.
+	Region string
+	// Credentials are the secret access keys by access key ID.  Requests must be signed with one of them
+	// with SigV4, in the Authorization header or in the query (presigned URLs).  If empty, requests are not
+	// authenticated.
+	Credentials map[string]string
+	// UploadsPrefix is the prefix of the parts of multipart uploads in the FS, which is hidden from the
+	// S3 API.  Defaults to DefaultUploadsPrefix.
+	UploadsPrefix string
+	// UploadExpiry is the duration after which incomplete multipart uploads are deleted, with their parts.
+	// Defaults to DefaultUploadExpiry.
+	UploadExpiry time.Duration
+
+	// Clock is used to check the time of the signatures.  Defaults to the system clock.
+	Clock storage.Clock
+}
+
+// Handler creates an http.Handler serving the S3 REST API, with path-style requests, on top of fs:
+// GetObject, HeadObject, PutObject, DeleteObject, ListObjectsV2, and the multipart upload operations
+// CreateMultipartUpload, UploadPart, CompleteMultipartUpload and AbortMultipartUpload.
+//
+// The ETags of objects are the MD5 of their content, including those created by multipart uploads.  The
+// state of multipart uploads is kept in memory, while their parts are stored in fs.  Expired uploads are
+// deleted when creating uploads, as well as the parts left in fs by a previous handler.
+//
+// Keys and listing prefixes with "." or ".." segments are rejected with InvalidArgument, since fs could
+// resolve them outside of the bucket.
+func Handler(fs storage.FS, options *Options) http.Handler {
+	if options == nil {
+		options = &Options{}
+	}
+	opts := *options
+	if opts.Bucket == "" {
+		opts.Bucket = DefaultBucket
+	}
+	if opts.Region == "" {
+		opts.Region = DefaultRegion
+	}
+	if opts.UploadsPrefix == "" {
+		opts.UploadsPrefix = DefaultUploadsPrefix
+	}
+	if opts.UploadExpiry == 0 {
+		opts.UploadExpiry = DefaultUploadExpiry
+	}
+
+	now := time.Now
+	if opts.Clock != nil {
+		now = opts.Clock.Now
+	}
+
+	return &handler{
+		fs:      fs,
+		options: &opts,
+		now:     now,
+		uploads: make(map[string]*upload),
+	}
+}
+
+type handler struct {
+	fs      storage.FS
+	options *Options
+	now     func() time.Time
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+	// lastCleanup is the time of the last deletion of the expired uploads.
+	lastCleanup time.Time
+}
+
+// ServeHTTP implements http.Handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.authenticate(r); err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case bucket == "":
+		if r.Method != http.MethodGet {
+			writeError(w, r, errMethodNotAllowed)
+
+			return
+		}
+		h.listBuckets(w)
+	case bucket != h.options.Bucket:
+		writeError(w, r, errNoSuchBucket)
+	case key == "":
+		h.serveBucket(w, r)
+	case hasDotSegment(key):
+		// The FS could resolve them outside of the bucket, e.g. localFS
+		writeError(w, r, errInvalidArgument)
+	case strings.HasPrefix(strings.TrimPrefix(path.Clean("/"+key), "/")+"/", h.options.UploadsPrefix):
+		// Cleaned, as the FS may ignore repeated slashes
+		writeError(w, r, errAccessDenied)
+	default:
+		h.serveObject(w, r, key)
+	}
+}
+
+// hasDotSegment returns whether key has "." or ".." segments.
+func hasDotSegment(key string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+
+	return false
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Buckets []struct {
+		Name string `xml:"Name"`
+	} `xml:"Buckets>Bucket"`
+}
+
+func (h *handler) listBuckets(w http.ResponseWriter) {
+	result := &listAllMyBucketsResult{Xmlns: s3Namespace}
+	result.Buckets = append(result.Buckets, struct {
+		Name string `xml:"Name"`
+	}{Name: h.options.Bucket})
+	writeXML(w, http.StatusOK, result)
+}
+
+func (h *handler) serveBucket(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && q.Get("list-type") == "2":
+		h.listObjectsV2(w, r)
+	case r.Method == http.MethodGet && q.Has("location"):
+		writeXML(w, http.StatusOK, &struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+			Xmlns   string   `xml:"xmlns,attr"`
+			Region  string   `xml:",chardata"`
+		}{Xmlns: s3Namespace, Region: h.options.Region})
+	case r.Method == http.MethodGet:
+		writeError(w, r, errNotImplemented)
+	default:
+		writeError(w, r, errMethodNotAllowed)
+	}
+}
+
+func (h *handler) serveObject(w http.ResponseWriter, r *http.Request, key string) {
+	q := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.getObject(w, r, key)
+	case http.MethodPut:
+		switch {
+		case q.Has("uploadId"):
+			h.uploadPart(w, r, key)
+		case r.Header.Get("X-Amz-Copy-Source") != "":
+			writeError(w, r, errNotImplemented)
+		default:
+			h.putObject(w, r, key)
+		}
+	case http.MethodPost:
+		switch {
+		case q.Has("uploads"):
+			h.createMultipartUpload(w, r, key)
+		case q.Has("uploadId"):
+			h.completeMultipartUpload(w, r, key)
+		default:
+			writeError(w, r, errMethodNotAllowed)
+		}
+	case http.MethodDelete:
+		if q.Has("uploadId") {
+			h.abortMultipartUpload(w, r, key)
+
+			return
+		}
+		if err := h.fs.Delete(r.Context(), key); err != nil && !storage.IsNotExist(err) {
+			writeError(w, r, err)
+
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, errMethodNotAllowed)
+	}
+}
+
+func etag(md5 []byte) string {
+	if len(md5) == 0 {
+		return ""
+	}
+
+	return `"` + hex.EncodeToString(md5) + `"`
+}
+
+// matchETag returns whether the If-Match or If-None-Match header value matches etag.
+func matchETag(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || (etag != "" && v == etag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setObjectHeaders sets the headers of an object with attrs.
+func setObjectHeaders(header http.Header, attrs *storage.Attributes) {
+	if attrs.ContentType != "" {
+		header.Set("Content-Type", attrs.ContentType)
+	}
+	if attrs.ContentEncoding != "" {
+		header.Set("Content-Encoding", attrs.ContentEncoding)
+	}
+	if !attrs.ModTime.IsZero() {
+		header.Set("Last-Modified", attrs.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if e := etag(attrs.MD5); e != "" {
+		header.Set("ETag", e)
+	}
+	for k, v := range attrs.Metadata {
+		header.Set(metadataPrefix+k, v)
+	}
+	header.Set("Accept-Ranges", "bytes")
+}
+
+// checkConditions checks the conditional headers of r against attrs, returning the status to respond
+// with if they don't hold.
+func checkConditions(r *http.Request, attrs *storage.Attributes) int {
+	e := etag(attrs.MD5)
+	if im := r.Header.Get("If-Match"); im != "" && !matchETag(im, e) {
+		return http.StatusPreconditionFailed
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if matchETag(inm, e) {
+			return http.StatusNotModified
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !attrs.ModTime.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !attrs.ModTime.Truncate(time.Second).After(t) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+func (h *handler) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	ctx := r.Context()
+	// Objects are served as stored, with their Content-Encoding
+	options := &storage.ReaderOptions{ReadCompressed: true}
+	attrs, err := h.fs.Attributes(ctx, key, options)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	header := w.Header()
+	setObjectHeaders(header, attrs)
+	switch status := checkConditions(r, attrs); status {
+	case 0:
+	case http.StatusPreconditionFailed:
+		writeError(w, r, errPreconditionFailed)
+
+		return
+	default:
+		w.WriteHeader(status)
+
+		return
+	}
+
+	start, length, ranged := int64(0), attrs.Size, false
+	if rh := r.Header.Get("Range"); rh != "" {
+		start, length, ranged, err = httprange.Parse(rh, attrs.Size)
+		if err != nil {
+			writeError(w, r, errInvalidRange)
+
+			return
+		}
+		if !ranged {
+			length = attrs.Size
+		}
+	}
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+
+	status := http.StatusOK
+	if ranged {
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, attrs.Size))
+		status = http.StatusPartialContent
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+
+		return
+	}
+
+	f, err := h.fs.Open(ctx, key, options)
+	if err != nil {
+		header.Del("Content-Length")
+		writeError(w, r, err)
+
+		return
+	}
+	defer f.Close()
+
+	if _, err := io.CopyN(io.Discard, f, start); err != nil {
+		header.Del("Content-Length")
+		writeError(w, r, err)
+
+		return
+	}
+	w.WriteHeader(status)
+	_, _ = io.Copy(w, io.LimitReader(f, length))
+}
+
+// writerOptions returns the options to create an object with the headers of r.
+func writerOptions(r *http.Request) (*storage.WriterOptions, error) {
+	options := &storage.WriterOptions{
+		Attributes: storage.Attributes{
+			ContentType:     r.Header.Get("Content-Type"),
+			ContentEncoding: r.Header.Get("Content-Encoding"),
+		},
+	}
+	for k, v := range r.Header {
+		if name, ok := strings.CutPrefix(k, metadataPrefix); ok {
+			if options.Attributes.Metadata == nil {
+				options.Attributes.Metadata = map[string]string{}
+			}
+			options.Attributes.Metadata[strings.ToLower(name)] = strings.Join(v, ",")
+		}
+	}
+	if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+		md5, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil || len(md5) != 16 {
+			return nil, errInvalidDigest
+		}
+		options.Attributes.MD5 = md5
+	}
+
+	return options, nil
+}
+
+// write creates path with the content of r, returning its MD5.
+func (h *handler) write(ctx context.Context, path string, r io.Reader, options *storage.WriterOptions) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wc, err := h.fs.Create(ctx, path, options)
+	if err != nil {
+		return nil, err
+	}
+	hash := md5.New() //nolint:gosec
+	if _, err := io.Copy(io.MultiWriter(wc, hash), r); err != nil {
+		storage.AbortWrite(cancel, wc)
+
+		return nil, err
+	}
+	if err := wc.Close(); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+func (h *handler) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	options, err := writerOptions(r)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	md5, err := h.write(r.Context(), key, r.Body, options)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+	w.Header().Set("ETag", etag(md5))
+	w.WriteHeader(http.StatusOK)
+}
+
+type listObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified,omitempty"`
+	ETag         string `xml:"ETag,omitempty"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	Contents              []listObject   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// keys returns the sorted keys starting with prefix, hiding the uploads.
+func (h *handler) keys(ctx context.Context, prefix string) ([]string, error) {
+	// Walk the directory of the prefix, as the local FS can only walk directories
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+
+	var keys []string
+	err := h.fs.Walk(ctx, dir, func(path string) error {
+		// Local paths start with a "/"
+		path = strings.TrimPrefix(path, "/")
+		if strings.HasPrefix(path, prefix) && !strings.HasPrefix(path, h.options.UploadsPrefix) {
+			keys = append(keys, path)
+		}
+
+		return nil
+	})
+	if err != nil && !storage.IsNotExist(err) && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func (h *handler) listObjectsV2(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	result := &listBucketResult{
+		Xmlns:             s3Namespace,
+		Name:              h.options.Bucket,
+		Prefix:            q.Get("prefix"),
+		Delimiter:         q.Get("delimiter"),
+		MaxKeys:           maxKeys,
+		ContinuationToken: q.Get("continuation-token"),
+		StartAfter:        q.Get("start-after"),
+	}
+	if hasDotSegment(result.Prefix) {
+		writeError(w, r, errInvalidArgument)
+
+		return
+	}
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, r, errInvalidArgument)
+
+			return
+		}
+		if n < maxKeys {
+			result.MaxKeys = n
+		}
+	}
+
+	// The continuation token is the last key or common prefix listed
+	marker := result.StartAfter
+	if result.ContinuationToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(result.ContinuationToken)
+		if err != nil {
+			writeError(w, r, errInvalidArgument)
+
+			return
+		}
+		marker = string(token)
+	}
+
+	keys, err := h.keys(ctx, result.Prefix)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	var last string
+	for _, key := range keys {
+		if key <= marker || (result.Delimiter != "" && strings.HasSuffix(marker, result.Delimiter) &&
+			strings.HasPrefix(key, marker)) {
+			continue
+		}
+
+		entry := key
+		if result.Delimiter != "" {
+			rest := strings.TrimPrefix(key, result.Prefix)
+			if i := strings.Index(rest, result.Delimiter); i >= 0 {
+				entry = result.Prefix + rest[:i+len(result.Delimiter)]
+			}
+		}
+		if entry == last {
+			continue
+		}
+
+		if result.KeyCount == result.MaxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+
+			break
+		}
+
+		if entry != key {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: entry})
+		} else {
+			attrs, err := h.fs.Attributes(ctx, key, &storage.ReaderOptions{ReadCompressed: true})
+			if storage.IsNotExist(err) {
+				// Deleted since Walk
+				continue
+			}
+			if err != nil {
+				writeError(w, r, err)
+
+				return
+			}
+			object := listObject{
+				Key:          key,
+				ETag:         etag(attrs.MD5),
+				Size:         attrs.Size,
+				StorageClass: "STANDARD",
+			}
+			if !attrs.ModTime.IsZero() {
+				object.LastModified = attrs.ModTime.UTC().Format(lastModifiedFmt)
+			}
+			result.Contents = append(result.Contents, object)
+		}
+		result.KeyCount++
+		last = entry
+	}
+
+	writeXML(w, http.StatusOK, result)
+}
@@ -0,0 +1,429 @@
+package storages3_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+	"github.com/Shopify/go-storage/storages3"
+)
+
+const bucket = "test-bucket"
+
+// withS3 serves fs with the S3 API, and calls cb with a client using the secret of "key".
+func withS3(t *testing.T, fs storage.FS, secret string, cb func(*s3.Client)) {
+	t.Helper()
+
+	srv := httptest.NewServer(storages3.Handler(fs, &storages3.Options{
+		Bucket:      bucket,
+		Credentials: map[string]string{"key": "secret"},
+	}))
+	defer srv.Close()
+
+	client := s3.New(s3.Options{
+		BaseEndpoint: aws.String(srv.URL),
+		Region:       storages3.DefaultRegion,
+		UsePathStyle: true,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "key", SecretAccessKey: secret}, nil
+		}),
+	})
+	cb(client)
+}
+
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+
+	return ""
+}
+
+func TestHandler_Objects(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewMemoryFS()
+	withS3(t, fs, "secret", func(client *s3.Client) {
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String("foo/bar baz"),
+			Body:        strings.NewReader("hello world"),
+			ContentType: aws.String("text/plain"),
+			Metadata:    map[string]string{"owner": "me"},
+		})
+		require.NoError(t, err)
+		testutils.OpenExists(t, fs, "foo/bar baz", "hello world")
+
+		head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String("foo/bar baz")})
+		require.NoError(t, err)
+		assert.Equal(t, int64(11), aws.ToInt64(head.ContentLength))
+		assert.Equal(t, "text/plain", aws.ToString(head.ContentType))
+		assert.Equal(t, map[string]string{"owner": "me"}, head.Metadata)
+
+		get, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String("foo/bar baz")})
+		require.NoError(t, err)
+		data, err := io.ReadAll(get.Body)
+		require.NoError(t, err)
+		require.NoError(t, get.Body.Close())
+		assert.Equal(t, "hello world", string(data))
+		assert.Equal(t, aws.ToString(head.ETag), aws.ToString(get.ETag))
+
+		get, err = client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String("foo/bar baz"),
+			Range:  aws.String("bytes=6-"),
+		})
+		require.NoError(t, err)
+		data, err = io.ReadAll(get.Body)
+		require.NoError(t, err)
+		require.NoError(t, get.Body.Close())
+		assert.Equal(t, "world", string(data))
+		assert.Equal(t, "bytes 6-10/11", aws.ToString(get.ContentRange))
+
+		_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String("foo/bar baz")})
+		require.NoError(t, err)
+
+		_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String("foo/bar baz")})
+		var noSuchKey *types.NoSuchKey
+		assert.ErrorAs(t, err, &noSuchKey)
+
+		_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("other"), Key: aws.String("foo")})
+		assert.Equal(t, "NoSuchBucket", errorCode(err))
+	})
+}
+
+func TestHandler_ListObjectsV2(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testListObjectsV2(t, storage.NewMemoryFS())
+	})
+	t.Run("local", func(t *testing.T) {
+		testListObjectsV2(t, storage.NewLocalFS(t.TempDir()))
+	})
+}
+
+func testListObjectsV2(t *testing.T, fs storage.FS) {
+	ctx := context.Background()
+	for _, path := range []string{"a/b", "a/c/d", "a/c/e", "a/f", "g"} {
+		testutils.Create(t, fs, path, path)
+	}
+
+	withS3(t, fs, "secret", func(client *s3.Client) {
+		out, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:    aws.String(bucket),
+			Prefix:    aws.String("a/"),
+			Delimiter: aws.String("/"),
+		})
+		require.NoError(t, err)
+		var keys, prefixes []string
+		for _, o := range out.Contents {
+			keys = append(keys, aws.ToString(o.Key))
+		}
+		for _, p := range out.CommonPrefixes {
+			prefixes = append(prefixes, aws.ToString(p.Prefix))
+		}
+		assert.Equal(t, []string{"a/b", "a/f"}, keys)
+		assert.Equal(t, []string{"a/c/"}, prefixes)
+		assert.Equal(t, int64(3), aws.ToInt64(out.Contents[0].Size))
+
+		// Pagination, with a partial prefix
+		var paged []string
+		paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+			Bucket:  aws.String(bucket),
+			Prefix:  aws.String("a/c"),
+			MaxKeys: aws.Int32(1),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(page.Contents), 1)
+			for _, o := range page.Contents {
+				paged = append(paged, aws.ToString(o.Key))
+			}
+		}
+		assert.Equal(t, []string{"a/c/d", "a/c/e"}, paged)
+	})
+}
+
+func TestHandler_MultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewMemoryFS()
+	withS3(t, fs, "secret", func(client *s3.Client) {
+		create, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String("big"),
+			ContentType: aws.String("application/octet-stream"),
+		})
+		require.NoError(t, err)
+
+		var parts []types.CompletedPart
+		for i, content := range []string{"first ", "second ", "third"} {
+			part, err := client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:     aws.String(bucket),
+				Key:        aws.String("big"),
+				UploadId:   create.UploadId,
+				PartNumber: aws.Int32(int32(i + 1)),
+				Body:       bytes.NewReader([]byte(content)),
+			})
+			require.NoError(t, err)
+			parts = append(parts, types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(int32(i + 1))})
+		}
+
+		// The parts are hidden
+		list, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+		require.NoError(t, err)
+		assert.Empty(t, list.Contents)
+
+		_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String("big"),
+			UploadId:        create.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+		require.NoError(t, err)
+		testutils.OpenExists(t, fs, "big", "first second third")
+
+		paths, err := storage.List(ctx, fs, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"big"}, paths)
+
+		// Aborting an upload
+		create, err = client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String("aborted"),
+		})
+		require.NoError(t, err)
+		_, err = client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String("aborted"),
+			UploadId:   create.UploadId,
+			PartNumber: aws.Int32(1),
+			Body:       strings.NewReader("part"),
+		})
+		require.NoError(t, err)
+		_, err = client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String("aborted"),
+			UploadId: create.UploadId,
+		})
+		require.NoError(t, err)
+		paths, err = storage.List(ctx, fs, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"big"}, paths)
+
+		_, err = client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String("aborted"),
+			UploadId:   create.UploadId,
+			PartNumber: aws.Int32(2),
+			Body:       strings.NewReader("part"),
+		})
+		assert.Equal(t, "NoSuchUpload", errorCode(err))
+	})
+}
+
+func TestHandler_Auth(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewMemoryFS()
+	testutils.Create(t, fs, "foo", "bar")
+
+	withS3(t, fs, "wrong", func(client *s3.Client) {
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String("foo"),
+			Body:   strings.NewReader("baz"),
+		})
+		assert.Equal(t, "SignatureDoesNotMatch", errorCode(err))
+		testutils.OpenExists(t, fs, "foo", "bar")
+	})
+
+	// Presigned URLs
+	withS3(t, fs, "secret", func(client *s3.Client) {
+		req, err := s3.NewPresignClient(client).PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String("foo"),
+		})
+		require.NoError(t, err)
+
+		resp, err := http.Get(req.URL) //nolint:noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "bar", string(data))
+
+		resp, err = http.Get(strings.Replace(req.URL, "foo", "fop", 1)) //nolint:noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		// The expiry of presigned URLs is bounded
+		for _, expires := range []string{"0", "-1", "604801"} {
+			resp, err = http.Get(strings.Replace(req.URL, "X-Amz-Expires=900", "X-Amz-Expires="+expires, 1)) //nolint:noctx
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, expires)
+		}
+	})
+
+	// The host must be signed
+	srv := httptest.NewServer(storages3.Handler(fs, &storages3.Options{
+		Bucket:      bucket,
+		Credentials: map[string]string{"key": "secret"},
+	}))
+	defer srv.Close()
+	req := signedRequest(t, http.MethodGet, srv.URL+"/"+bucket+"/foo", "", "")
+	auth := req.Header.Get("Authorization")
+	require.Contains(t, auth, "SignedHeaders=host;")
+	req.Header.Set("Authorization", strings.Replace(auth, "SignedHeaders=host;", "SignedHeaders=", 1))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// signedRequest returns a request signed with the secret of "key", with the SHA-256 of payload.
+func signedRequest(t *testing.T, method, url, body, payload string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	hash := sha256.Sum256([]byte(payload))
+	payloadHash := hex.EncodeToString(hash[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	creds := aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"}
+	require.NoError(t, v4.NewSigner().SignHTTP(context.Background(), creds, req, payloadHash, "s3", storages3.DefaultRegion, time.Now()))
+
+	return req
+}
+
+func TestHandler_PayloadHash(t *testing.T) {
+	fs := storage.NewMemoryFS()
+	srv := httptest.NewServer(storages3.Handler(fs, &storages3.Options{
+		Bucket:      bucket,
+		Credentials: map[string]string{"key": "secret"},
+	}))
+	defer srv.Close()
+
+	resp, err := http.DefaultClient.Do(signedRequest(t, http.MethodPut, srv.URL+"/"+bucket+"/foo", "hello", "hello"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	testutils.OpenExists(t, fs, "foo", "hello")
+
+	// The body is only known not to match at its end, it must not be written
+	resp, err = http.DefaultClient.Do(signedRequest(t, http.MethodPut, srv.URL+"/"+bucket+"/bar", "world", "hello"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	testutils.OpenNotExists(t, fs, "bar")
+}
+
+func TestHandler_keyTraversal(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0o600))
+	fs := storage.NewLocalFS(filepath.Join(dir, "root"))
+	testutils.Create(t, fs, storages3.DefaultUploadsPrefix+"upload/00001", "part")
+	srv := httptest.NewServer(storages3.Handler(fs, &storages3.Options{
+		Bucket:      bucket,
+		Credentials: map[string]string{"key": "secret"},
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/" + bucket + "/../secret", http.StatusBadRequest},
+		{http.MethodGet, "/" + bucket + "/a/../../secret", http.StatusBadRequest},
+		{http.MethodDelete, "/" + bucket + "/./secret", http.StatusBadRequest},
+		{http.MethodGet, "/" + bucket + "?list-type=2&prefix=../", http.StatusBadRequest},
+		// The uploads are hidden, whatever the slashes
+		{http.MethodGet, "/" + bucket + "//" + storages3.DefaultUploadsPrefix + "upload/00001", http.StatusForbidden},
+		{http.MethodDelete, "/" + bucket + "/.uploads", http.StatusForbidden},
+	} {
+		resp, err := http.DefaultClient.Do(signedRequest(t, tt.method, srv.URL+tt.path, "", ""))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, tt.status, resp.StatusCode, tt.path)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "secret"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(data))
+	testutils.OpenExists(t, fs, storages3.DefaultUploadsPrefix+"upload/00001", "part")
+}
+
+func TestHandler_UploadExpiry(t *testing.T) {
+	ctx := context.Background()
+	fs := storage.NewMemoryFS()
+	// A part left by a previous handler
+	testutils.Create(t, fs, storages3.DefaultUploadsPrefix+"previous/00001", "part")
+	clock := testutils.NewFakeClock(time.Now())
+
+	srv := httptest.NewServer(storages3.Handler(fs, &storages3.Options{Bucket: bucket, Clock: clock}))
+	defer srv.Close()
+	client := s3.New(s3.Options{
+		BaseEndpoint: aws.String(srv.URL),
+		Region:       storages3.DefaultRegion,
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	createUpload := func(key string) *string {
+		create, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		require.NoError(t, err)
+
+		return create.UploadId
+	}
+	uploadPart := func(key string, id *string) error {
+		_, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(key),
+			UploadId:   id,
+			PartNumber: aws.Int32(1),
+			Body:       strings.NewReader("part"),
+		})
+
+		return err
+	}
+
+	id := createUpload("expired")
+	require.NoError(t, uploadPart("expired", id))
+	paths, err := storage.List(ctx, fs, storages3.DefaultUploadsPrefix)
+	require.NoError(t, err)
+	assert.Len(t, paths, 2, "the part of the previous handler is not expired yet")
+
+	clock.Advance(storages3.DefaultUploadExpiry)
+	assert.Equal(t, "NoSuchUpload", errorCode(uploadPart("expired", id)))
+
+	// Creating an upload deletes the expired ones
+	id = createUpload("new")
+	require.NoError(t, uploadPart("new", id))
+	paths, err = storage.List(ctx, fs, storages3.DefaultUploadsPrefix)
+	require.NoError(t, err)
+	assert.Equal(t, []string{storages3.DefaultUploadsPrefix + *id + "/00001"}, paths)
+}
@@ -0,0 +1,320 @@
+package storages3
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/go-storage"
+)
+
+const (
+	maxPartNumber = 10000
+	// cleanupInterval is the minimum interval between deletions of the expired uploads.
+	cleanupInterval = time.Hour
+)
+
+// upload is an in-progress multipart upload.
+type upload struct {
+	key     string
+	options *storage.WriterOptions
+	created time.Time
+	// parts are the ETags of the parts uploaded, by part number.
+	parts map[int]string
+}
+
+// partPath returns the path of a part of an upload in the FS.
+func (h *handler) partPath(uploadID string, partNumber int) string {
+	return fmt.Sprintf("%s%s/%05d", h.options.UploadsPrefix, uploadID, partNumber)
+}
+
+// upload returns the upload of r for key.
+func (h *handler) upload(r *http.Request, key string) (string, *upload, error) {
+	id := r.URL.Query().Get("uploadId")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	u, ok := h.uploads[id]
+	if !ok || u.key != key || h.expired(u.created) {
+		return "", nil, errNoSuchUpload
+	}
+
+	return id, u, nil
+}
+
+// expired returns whether an upload created at created is expired.
+func (h *handler) expired(created time.Time) bool {
+	return !h.now().Before(created.Add(h.options.UploadExpiry))
+}
+
+// cleanup deletes the expired uploads with their parts, and the expired parts which don't belong to any
+// upload, e.g. left by a previous handler.  It runs at most once per cleanupInterval.
+func (h *handler) cleanup(ctx context.Context) {
+	h.mu.Lock()
+	if h.now().Before(h.lastCleanup.Add(cleanupInterval)) {
+		h.mu.Unlock()
+
+		return
+	}
+	h.lastCleanup = h.now()
+	expired := make(map[string]*upload)
+	for id, u := range h.uploads {
+		if h.expired(u.created) {
+			expired[id] = u
+		}
+	}
+	h.mu.Unlock()
+
+	for id, u := range expired {
+		h.deleteUpload(ctx, id, u)
+	}
+
+	_ = h.fs.Walk(ctx, h.options.UploadsPrefix, func(path string) error {
+		// Local paths start with a "/"
+		path = strings.TrimPrefix(path, "/")
+		id, _, _ := strings.Cut(strings.TrimPrefix(path, h.options.UploadsPrefix), "/")
+
+		h.mu.Lock()
+		_, ok := h.uploads[id]
+		h.mu.Unlock()
+		if ok {
+			return nil
+		}
+
+		if attrs, err := h.fs.Attributes(ctx, path, nil); err == nil && h.expired(attrs.ModTime) {
+			_ = h.fs.Delete(ctx, path)
+		}
+
+		return nil
+	})
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+func (h *handler) createMultipartUpload(w http.ResponseWriter, r *http.Request, key string) {
+	options, err := writerOptions(r)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+	// The checksums are of the parts
+	options.Attributes.MD5 = nil
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+	id := hex.EncodeToString(b)
+
+	h.cleanup(r.Context())
+
+	h.mu.Lock()
+	h.uploads[id] = &upload{
+		key:     key,
+		options: options,
+		created: h.now(),
+		parts:   make(map[int]string),
+	}
+	h.mu.Unlock()
+
+	writeXML(w, http.StatusOK, &initiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   h.options.Bucket,
+		Key:      key,
+		UploadID: id,
+	})
+}
+
+func (h *handler) uploadPart(w http.ResponseWriter, r *http.Request, key string) {
+	id, u, err := h.upload(r, key)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		writeError(w, r, errInvalidArgument)
+
+		return
+	}
+	options, err := writerOptions(r)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	md5, err := h.write(r.Context(), h.partPath(id, partNumber), r.Body, &storage.WriterOptions{
+		Attributes: storage.Attributes{MD5: options.Attributes.MD5},
+	})
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	h.mu.Lock()
+	u.parts[partNumber] = etag(md5)
+	h.mu.Unlock()
+
+	w.Header().Set("ETag", etag(md5))
+	w.WriteHeader(http.StatusOK)
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+// partsReader reads the parts of an upload in order.
+type partsReader struct {
+	h     *handler
+	r     *http.Request
+	paths []string
+	f     *storage.File
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.f == nil {
+			if len(p.paths) == 0 {
+				return 0, io.EOF
+			}
+			f, err := p.h.fs.Open(p.r.Context(), p.paths[0], nil)
+			if err != nil {
+				return 0, err
+			}
+			p.f, p.paths = f, p.paths[1:]
+		}
+
+		n, err := p.f.Read(b)
+		if err == io.EOF { //nolint:errorlint // io.EOF is never wrapped by Read.
+			err = p.f.Close()
+			p.f = nil
+			if n > 0 || err != nil {
+				return n, err
+			}
+
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() error {
+	if p.f == nil {
+		return nil
+	}
+
+	return p.f.Close()
+}
+
+func (h *handler) completeMultipartUpload(w http.ResponseWriter, r *http.Request, key string) {
+	id, u, err := h.upload(r, key)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	var complete completeMultipartUpload
+	if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil || len(complete.Parts) == 0 {
+		writeError(w, r, errMalformedXML)
+
+		return
+	}
+
+	h.mu.Lock()
+	var paths []string
+	for i, part := range complete.Parts {
+		if i > 0 && part.PartNumber <= complete.Parts[i-1].PartNumber {
+			err = errInvalidPartOrder
+
+			break
+		}
+		if e, ok := u.parts[part.PartNumber]; !ok || e != `"`+strings.Trim(part.ETag, `"`)+`"` {
+			err = errInvalidPart
+
+			break
+		}
+		paths = append(paths, h.partPath(id, part.PartNumber))
+	}
+	h.mu.Unlock()
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+
+	parts := &partsReader{h: h, r: r, paths: paths}
+	defer parts.Close()
+	md5, err := h.write(r.Context(), key, parts, u.options)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+	h.deleteUpload(r.Context(), id, u)
+
+	writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:  s3Namespace,
+		Bucket: h.options.Bucket,
+		Key:    key,
+		ETag:   etag(md5),
+	})
+}
+
+// deleteUpload deletes the upload, and its parts in the FS.
+func (h *handler) deleteUpload(ctx context.Context, id string, u *upload) {
+	h.mu.Lock()
+	delete(h.uploads, id)
+	parts := make([]int, 0, len(u.parts))
+	for partNumber := range u.parts {
+		parts = append(parts, partNumber)
+	}
+	h.mu.Unlock()
+
+	for _, partNumber := range parts {
+		_ = h.fs.Delete(ctx, h.partPath(id, partNumber))
+	}
+}
+
+func (h *handler) abortMultipartUpload(w http.ResponseWriter, r *http.Request, key string) {
+	id, u, err := h.upload(r, key)
+	if err != nil {
+		writeError(w, r, err)
+
+		return
+	}
+	h.deleteUpload(r.Context(), id, u)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// ThrottleRate is a byte-rate limit.
+type ThrottleRate struct {
+	// BytesPerSecond is the sustained rate.  If 0, there is no limit.
+	BytesPerSecond int
+	// Burst is the number of bytes which can be transferred at once, above the sustained rate.
+	// Defaults to BytesPerSecond.
+	Burst int
+}
+
+func (r ThrottleRate) limiter() *rate.Limiter {
+	if r.BytesPerSecond <= 0 {
+		return nil
+	}
+
+	burst := r.Burst
+	if burst <= 0 {
+		burst = r.BytesPerSecond
+	}
+
+	return rate.NewLimiter(rate.Limit(r.BytesPerSecond), burst)
+}
+
+// ThrottleOptions are used to configure NewThrottleWrapper.
+type ThrottleOptions struct {
+	// Read limits the bytes read from all Files opened through the FS.
+	Read ThrottleRate
+	// Write limits the bytes written to all writers created through the FS.
+	Write ThrottleRate
+
+	// PathRead limits the bytes read from Files for each path, on top of Read.
+	PathRead ThrottleRate
+	// PathWrite limits the bytes written to writers for each path, on top of Write.
+	PathWrite ThrottleRate
+}
+
+// NewThrottleWrapper creates an FS which limits the throughput of reading Files and writing to the
+// writers returned by Create.
+// Limits apply to the whole FS and, optionally, to each path.
+//
+// This can be used to protect shared links, or to simulate a slow network in tests.
+// Unlike NewSlowWrapper, the delay is proportional to the amount of data transferred.
+func NewThrottleWrapper(fs FS, options *ThrottleOptions) FS {
+	if options == nil {
+		options = &ThrottleOptions{}
+	}
+
+	return &throttleWrapper{
+		fs:      fs,
+		options: options,
+		read:    options.Read.limiter(),
+		write:   options.Write.limiter(),
+		paths:   make(map[string]*pathLimiters),
+	}
+}
+
+type throttleWrapper struct {
+	fs      FS
+	options *ThrottleOptions
+
+	read  *rate.Limiter
+	write *rate.Limiter
+
+	pathsLock sync.Mutex
+	paths     map[string]*pathLimiters
+}
+
+// pathLimiters are the limiters of a path, shared by all its open Files and writers.
+type pathLimiters struct {
+	refs  int
+	read  *rate.Limiter
+	write *rate.Limiter
+}
+
+// pathLimiters returns the limiters of path.  The returned func must be called once they are no longer
+// in use.
+func (t *throttleWrapper) pathLimiters(path string) (*pathLimiters, func()) {
+	t.pathsLock.Lock()
+	defer t.pathsLock.Unlock()
+
+	l, ok := t.paths[path]
+	if !ok {
+		l = &pathLimiters{
+			read:  t.options.PathRead.limiter(),
+			write: t.options.PathWrite.limiter(),
+		}
+		t.paths[path] = l
+	}
+	l.refs++
+
+	var once sync.Once
+
+	return l, func() {
+		once.Do(func() {
+			t.pathsLock.Lock()
+			defer t.pathsLock.Unlock()
+
+			l.refs--
+			if l.refs == 0 {
+				delete(t.paths, path)
+			}
+		})
+	}
+}
+
+// throttle holds the limiters applying to a single read or write stream.
+type throttle struct {
+	ctx      context.Context
+	limiters []*rate.Limiter
+}
+
+func newThrottle(ctx context.Context, limiters ...*rate.Limiter) *throttle {
+	t := &throttle{ctx: ctx}
+	for _, l := range limiters {
+		if l != nil {
+			t.limiters = append(t.limiters, l)
+		}
+	}
+
+	return t
+}
+
+// chunk returns the largest number of bytes which can be transferred in one go, capped at n.
+func (t *throttle) chunk(n int) int {
+	for _, l := range t.limiters {
+		if b := l.Burst(); b < n {
+			n = b
+		}
+	}
+
+	return n
+}
+
+func (t *throttle) wait(n int) error {
+	for _, l := range t.limiters {
+		if err := l.WaitN(t.ctx, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type throttleReadCloser struct {
+	io.ReadCloser
+	throttle *throttle
+	release  func()
+}
+
+func (r *throttleReadCloser) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return r.ReadCloser.Read(p)
+	}
+
+	n, err := r.ReadCloser.Read(p[:r.throttle.chunk(len(p))])
+	if n > 0 {
+		if err := r.throttle.wait(n); err != nil {
+			return n, err
+		}
+	}
+
+	return n, err
+}
+
+func (r *throttleReadCloser) Close() error {
+	defer r.release()
+
+	return r.ReadCloser.Close()
+}
+
+type throttleWriteCloser struct {
+	io.WriteCloser
+	throttle *throttle
+	release  func()
+}
+
+func (w *throttleWriteCloser) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := w.throttle.chunk(len(p))
+		if err := w.throttle.wait(chunk); err != nil {
+			return written, err
+		}
+
+		n, err := w.WriteCloser.Write(p[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[chunk:]
+	}
+
+	return written, nil
+}
+
+func (w *throttleWriteCloser) Close() error {
+	defer w.release()
+
+	return w.WriteCloser.Close()
+}
+
+// Open implements FS.  Reading the returned File is throttled.
+func (t *throttleWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	f, err := t.fs.Open(ctx, path, options)
+	if err != nil {
+		return nil, err
+	}
+
+	pl, release := t.pathLimiters(path)
+	f.ReadCloser = &throttleReadCloser{
+		ReadCloser: f.ReadCloser,
+		throttle:   newThrottle(ctx, t.read, pl.read),
+		release:    release,
+	}
+
+	return f, nil
+}
+
+// Attributes implements FS.
+func (t *throttleWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	return t.fs.Attributes(ctx, path, options)
+}
+
+// Create implements FS.  Writing to the returned writer is throttled.
+func (t *throttleWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	w, err := t.fs.Create(ctx, path, options)
+	if err != nil {
+		return nil, err
+	}
+
+	pl, release := t.pathLimiters(path)
+
+	return &throttleWriteCloser{
+		WriteCloser: w,
+		throttle:    newThrottle(ctx, t.write, pl.write),
+		release:     release,
+	}, nil
+}
+
+// Delete implements FS.
+func (t *throttleWrapper) Delete(ctx context.Context, path string) error {
+	return t.fs.Delete(ctx, path)
+}
+
+// Walk implements FS.
+func (t *throttleWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	return t.fs.Walk(ctx, path, fn)
+}
+
+func (t *throttleWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	// Pass-through
+	return t.fs.URL(ctx, path, options)
+}
@@ -0,0 +1,54 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func TestThrottleWrapper(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		fs := storage.NewThrottleWrapper(mem, &storage.ThrottleOptions{
+			Read:      storage.ThrottleRate{BytesPerSecond: 1024},
+			PathWrite: storage.ThrottleRate{BytesPerSecond: 1024},
+		})
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+	})
+}
+
+func TestThrottleWrapper_rate(t *testing.T) {
+	ctx := context.Background()
+	content := strings.Repeat("a", 300)
+	throttleRate := storage.ThrottleRate{BytesPerSecond: 1000, Burst: 100}
+	// The burst is transferred immediately, the remaining 200 bytes take 200ms
+	expected := 200 * time.Millisecond
+
+	withMem(func(mem storage.FS) {
+		fs := storage.NewThrottleWrapper(mem, &storage.ThrottleOptions{
+			Read:  throttleRate,
+			Write: throttleRate,
+		})
+
+		start := time.Now()
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte(content), nil))
+		assert.WithinDuration(t, start.Add(expected), time.Now(), expected/2)
+
+		f, err := fs.Open(ctx, "foo", nil)
+		require.NoError(t, err)
+		start = time.Now()
+		b, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(b))
+		assert.WithinDuration(t, start.Add(expected), time.Now(), expected/2)
+		require.NoError(t, f.Close())
+	})
+}
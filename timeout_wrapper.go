@@ -3,9 +3,33 @@ package storage
 import (
 	"context"
 	"io"
+	"sync/atomic"
 	"time"
 )
 
+// TimeoutOptions are used to configure NewTimeoutWrapperWithOptions.
+// A duration <= 0 disables the corresponding timeout.
+type TimeoutOptions struct {
+	// Read is the timeout of read operations: Open, Attributes, URL.
+	Read time.Duration
+	// Write is the timeout of write operations: Create, Delete.
+	Write time.Duration
+
+	// ReadIdle is the maximum duration of a single Read on a File returned by Open.
+	ReadIdle time.Duration
+	// WriteIdle is the maximum duration of a single Write, or of Close, on a writer returned by Create.
+	WriteIdle time.Duration
+	// Transfer is the maximum duration a File or writer can be used for, starting when it is returned.
+	Transfer time.Duration
+
+	// WalkPage is the maximum time Walk can wait for the next path, i.e. for the next page of the listing.
+	// The time spent in the WalkFn is not included.
+	WalkPage time.Duration
+
+	// Clock is used for the timeouts.  Defaults to the system clock.
+	Clock Clock
+}
+
 // NewTimeoutWrapper creates a FS which wraps fs and adds a timeout to most operations:
 // read: Open, Attributes, URL
 // write: Create, Delete
@@ -17,60 +41,231 @@ import (
 // It is at least supported on the CloudStorageFS.
 //
 // Walk is not covered, since its duration is highly unpredictable.
+// A timeout <= 0 disables the timeout of the corresponding operations, which used to fail immediately.
+// See NewTimeoutWrapperWithOptions to cover reading and writing the contents, and Walk.
 func NewTimeoutWrapper(fs FS, read time.Duration, write time.Duration) FS {
+	return NewTimeoutWrapperWithOptions(fs, &TimeoutOptions{
+		Read:  read,
+		Write: write,
+	})
+}
+
+// NewTimeoutWrapperWithOptions creates a FS which wraps fs and adds timeouts to operations,
+// to reading and writing the contents, and to Walk.
+//
+// This depends on the underlying implementation to honour context's errors.
+// It is at least supported on the CloudStorageFS.
+func NewTimeoutWrapperWithOptions(fs FS, options *TimeoutOptions) FS {
+	if options == nil {
+		options = &TimeoutOptions{}
+	}
+
 	return &timeoutWrapper{
-		fs:    fs,
-		read:  read,
-		write: write,
+		fs:      fs,
+		options: options,
+		clock:   clockOrDefault(options.Clock),
 	}
 }
 
 type timeoutWrapper struct {
-	fs    FS
-	read  time.Duration
-	write time.Duration
+	fs      FS
+	options *TimeoutOptions
+	clock   Clock
+}
+
+type timeoutResult struct {
+	out interface{}
+	err error
 }
 
 // timeoutCall watches the context to be sure it's not Done yet,
-// but does NOT modify the context being passed to the underlying call.
+// but does NOT add a deadline to the context being passed to the underlying call.
 // This is important, because the context needs to continue to be alive while the returned object (File, Writer, etc)
 // is being used by the caller.
-func timeoutCall(ctx context.Context, timeout time.Duration, call func() (interface{}, error)) (interface{}, error) {
-	var out interface{}
-	var err error
-	done := make(chan struct{})
+//
+// If the call returns after the timeout, discard is called with its result so it doesn't leak.
+func timeoutCall(ctx context.Context, clock Clock, timeout time.Duration, call func() (interface{}, error), discard func(interface{})) (interface{}, error) {
+	if timeout <= 0 {
+		return call()
+	}
+
+	done := make(chan timeoutResult, 1)
 	go func() {
-		out, err = call()
-		close(done)
+		out, err := call()
+		done <- timeoutResult{out: out, err: err}
 	}()
 
+	timer := clock.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
 	select {
-	case <-time.After(timeout):
-		return nil, context.DeadlineExceeded
+	case <-timer.C():
+		err = context.DeadlineExceeded
 	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-done:
-		return out, err
+		err = ctx.Err()
+	case res := <-done:
+		return res.out, res.err
+	}
+
+	go func() {
+		if res := <-done; res.err == nil && discard != nil {
+			discard(res.out)
+		}
+	}()
+
+	return nil, err
+}
+
+// streamDeadline cancels the context of a File or writer when its idle or transfer timeout fires.
+type streamDeadline struct {
+	cancel    context.CancelFunc
+	idle      time.Duration
+	idleTimer Timer
+	transfer  Timer
+	expired   atomic.Bool
+}
+
+func newStreamDeadline(clock Clock, cancel context.CancelFunc, idle time.Duration, transfer time.Duration) *streamDeadline {
+	d := &streamDeadline{
+		cancel: cancel,
+		idle:   idle,
+	}
+	if idle > 0 {
+		d.idleTimer = clock.AfterFunc(idle, d.expire)
+		d.idleTimer.Stop()
+	}
+	if transfer > 0 {
+		d.transfer = clock.AfterFunc(transfer, d.expire)
+	}
+
+	return d
+}
+
+func (d *streamDeadline) expire() {
+	d.expired.Store(true)
+	d.cancel()
+}
+
+// start starts the idle timeout.
+func (d *streamDeadline) start() {
+	if d.idleTimer != nil {
+		d.idleTimer.Reset(d.idle)
+	}
+}
+
+// pause stops the idle timeout.
+func (d *streamDeadline) pause() {
+	if d.idleTimer != nil {
+		d.idleTimer.Stop()
+	}
+}
+
+// err replaces err with context.DeadlineExceeded if a timeout fired.
+func (d *streamDeadline) err(err error) error {
+	if d.expired.Load() {
+		return context.DeadlineExceeded
+	}
+
+	return err
+}
+
+// do runs fn within the idle timeout.
+func (d *streamDeadline) do(fn func() error) error {
+	if d.expired.Load() {
+		return context.DeadlineExceeded
+	}
+
+	d.start()
+	err := fn()
+	d.pause()
+
+	return d.err(err)
+}
+
+func (d *streamDeadline) stop() {
+	d.pause()
+	if d.transfer != nil {
+		d.transfer.Stop()
 	}
+	d.cancel()
+}
+
+type timeoutReadCloser struct {
+	io.ReadCloser
+	deadline *streamDeadline
+}
+
+func (r *timeoutReadCloser) Read(p []byte) (n int, err error) {
+	err = r.deadline.do(func() (err error) {
+		n, err = r.ReadCloser.Read(p)
+
+		return err
+	})
+
+	return n, err
+}
+
+func (r *timeoutReadCloser) Close() error {
+	defer r.deadline.stop()
+
+	return r.ReadCloser.Close()
+}
+
+type timeoutWriteCloser struct {
+	io.WriteCloser
+	deadline *streamDeadline
+}
+
+func (w *timeoutWriteCloser) Write(p []byte) (n int, err error) {
+	err = w.deadline.do(func() (err error) {
+		n, err = w.WriteCloser.Write(p)
+
+		return err
+	})
+
+	return n, err
+}
+
+func (w *timeoutWriteCloser) Close() error {
+	defer w.deadline.stop()
+
+	return w.deadline.do(w.WriteCloser.Close)
 }
 
 // Open implements FS.
 func (t *timeoutWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
-	out, err := timeoutCall(ctx, t.read, func() (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	out, err := timeoutCall(ctx, t.clock, t.options.Read, func() (interface{}, error) {
 		return t.fs.Open(ctx, path, options)
+	}, func(out interface{}) {
+		if file, ok := out.(*File); ok && file != nil {
+			_ = file.Close()
+		}
 	})
-	if file, ok := out.(*File); ok {
-		return file, err
+	if err != nil {
+		cancel()
+
+		return nil, err
 	}
 
-	return nil, err
+	file := out.(*File)
+	file.ReadCloser = &timeoutReadCloser{
+		ReadCloser: file.ReadCloser,
+		deadline:   newStreamDeadline(t.clock, cancel, t.options.ReadIdle, t.options.Transfer),
+	}
+
+	return file, nil
 }
 
 // Attributes() implements FS.
 func (t *timeoutWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
-	out, err := timeoutCall(ctx, t.read, func() (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	out, err := timeoutCall(ctx, t.clock, t.options.Read, func() (interface{}, error) {
 		return t.fs.Attributes(ctx, path, options)
-	})
+	}, nil)
 	if attrs, ok := out.(*Attributes); ok {
 		return attrs, err
 	}
@@ -80,34 +275,78 @@ func (t *timeoutWrapper) Attributes(ctx context.Context, path string, options *R
 
 // Create implements FS.
 func (t *timeoutWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
-	out, err := timeoutCall(ctx, t.write, func() (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	out, err := timeoutCall(ctx, t.clock, t.options.Write, func() (interface{}, error) {
 		return t.fs.Create(ctx, path, options)
+	}, func(out interface{}) {
+		// The context is cancelled by now, so closing aborts the write on backends honouring it.
+		if w, ok := out.(io.WriteCloser); ok && w != nil {
+			_ = w.Close()
+		}
 	})
-	if w, ok := out.(io.WriteCloser); ok {
-		return w, err
+	if err != nil {
+		cancel()
+
+		return nil, err
 	}
 
-	return nil, err
+	return &timeoutWriteCloser{
+		WriteCloser: out.(io.WriteCloser),
+		deadline:    newStreamDeadline(t.clock, cancel, t.options.WriteIdle, t.options.Transfer),
+	}, nil
 }
 
 // Delete implements FS.
 func (t *timeoutWrapper) Delete(ctx context.Context, path string) error {
-	_, err := timeoutCall(ctx, t.write, func() (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	_, err := timeoutCall(ctx, t.clock, t.options.Write, func() (interface{}, error) {
 		return nil, t.fs.Delete(ctx, path)
-	})
+	}, nil)
 
 	return err
 }
 
 // Walk transverses all paths underneath path, calling fn on each visited path.
+// If WalkPage is set, Walk fails when waiting for the next path takes longer than WalkPage.
 func (t *timeoutWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
-	return t.fs.Walk(ctx, path, fn)
+	if t.options.WalkPage <= 0 {
+		return t.fs.Walk(ctx, path, fn)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	deadline := newStreamDeadline(t.clock, cancel, t.options.WalkPage, 0)
+	defer deadline.stop()
+
+	deadline.start()
+	err := t.fs.Walk(ctx, path, func(path string) error {
+		// The time spent in fn doesn't count towards the timeout.
+		deadline.pause()
+		if deadline.expired.Load() {
+			return context.DeadlineExceeded
+		}
+		if err := fn(path); err != nil {
+			return err
+		}
+		deadline.start()
+
+		return nil
+	})
+	deadline.pause()
+
+	return deadline.err(err)
 }
 
 func (t *timeoutWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
-	out, err := timeoutCall(ctx, t.write, func() (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	out, err := timeoutCall(ctx, t.clock, t.options.Read, func() (interface{}, error) {
 		return t.fs.URL(ctx, path, options)
-	})
+	}, nil)
 	if url, ok := out.(string); ok {
 		return url, err
 	}
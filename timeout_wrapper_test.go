@@ -2,11 +2,17 @@ package storage_test
 
 import (
 	"context"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
 )
 
 func TestNewTimeoutWrapper(t *testing.T) {
@@ -17,3 +23,107 @@ func TestNewTimeoutWrapper(t *testing.T) {
 		assert.EqualError(t, err, "context deadline exceeded")
 	})
 }
+
+func TestNewTimeoutWrapper_lateFileIsClosed(t *testing.T) {
+	rc := &closeRecorder{Reader: strings.NewReader("bar")}
+	mockFS := storage.NewMockFS()
+	mockFS.On("Open", mock.Anything, "foo", mock.Anything).After(2*slowDelay).Return(&storage.File{ReadCloser: rc}, nil)
+
+	fs := storage.NewTimeoutWrapper(mockFS, slowDelay, slowDelay)
+	file, err := fs.Open(context.Background(), "foo", nil)
+	assert.Nil(t, file)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.Eventually(t, rc.closed.Load, 4*slowDelay, 10*time.Millisecond)
+}
+
+func TestNewTimeoutWrapper_URL(t *testing.T) {
+	mockFS := storage.NewMockFS()
+	mockFS.On("URL", mock.Anything, "foo", mock.Anything).After(2*slowDelay).Return("url", nil)
+
+	// URL is a read operation
+	fs := storage.NewTimeoutWrapper(mockFS, slowDelay, 0)
+	_, err := fs.URL(context.Background(), "foo", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// A timeout <= 0 is disabled
+	fs = storage.NewTimeoutWrapper(mockFS, 0, slowDelay)
+	url, err := fs.URL(context.Background(), "foo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "url", url)
+}
+
+func TestNewTimeoutWrapperWithOptions_ReadIdle(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		testutils.Create(t, mem, "foo", "bar")
+
+		// Reading a byte takes 100ms after the first one
+		fs := storage.NewThrottleWrapper(mem, &storage.ThrottleOptions{
+			Read: storage.ThrottleRate{BytesPerSecond: 10, Burst: 1},
+		})
+		fs = storage.NewTimeoutWrapperWithOptions(fs, &storage.TimeoutOptions{
+			ReadIdle: 20 * time.Millisecond,
+		})
+
+		f, err := fs.Open(ctx, "foo", nil)
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(f)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		require.NoError(t, f.Close())
+	})
+}
+
+func TestNewTimeoutWrapperWithOptions_WalkPage(t *testing.T) {
+	ctx := context.Background()
+
+	withSlowWrapper(slowDelay, 0, func(fs storage.FS) {
+		testutils.Create(t, fs, "foo", "bar")
+
+		fs = storage.NewTimeoutWrapperWithOptions(fs, &storage.TimeoutOptions{
+			WalkPage: slowDelay / 2,
+		})
+		err := fs.Walk(ctx, "", func(string) error { return nil })
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	withMem(func(fs storage.FS) {
+		testutils.Create(t, fs, "foo", "bar")
+
+		// Time spent in the WalkFn is not included
+		fs = storage.NewTimeoutWrapperWithOptions(fs, &storage.TimeoutOptions{
+			WalkPage: slowDelay / 2,
+		})
+		err := fs.Walk(ctx, "", func(string) error {
+			time.Sleep(slowDelay)
+
+			return nil
+		})
+		assert.NoError(t, err)
+	})
+}
+
+func TestNewTimeoutWrapperWithOptions_Clock(t *testing.T) {
+	clock := testutils.NewFakeClock(time.Now())
+	slow := storage.NewSlowWrapperWithOptions(storage.NewMemoryFS(), &storage.SlowOptions{
+		ReadDelay: time.Hour,
+		Clock:     clock,
+	})
+	fs := storage.NewTimeoutWrapperWithOptions(slow, &storage.TimeoutOptions{
+		Read:  time.Minute,
+		Clock: clock,
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := fs.Attributes(context.Background(), "foo", nil)
+		done <- err
+	}()
+
+	// The timeout and the delay
+	clock.WaitForTimers(2)
+	clock.Advance(time.Minute)
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/Shopify/go-storage"
+
+// NewTracingWrapper creates an FS which records a span with tp for each call to fs, as a child of the span
+// of the context.  The context of the span is passed to fs.
+//
+// Spans have the "storage.path" and "storage.backend" attributes, and "storage.bucket" for Google Cloud
+// Storage.  The spans of Open and Create end when the File or writer is closed, with the "storage.bytes"
+// read or written, and Walk spans have the "storage.walk.entries" walked.  Errors are recorded on the spans,
+// except the errors of paths which do not exist.
+func NewTracingWrapper(fs FS, tp trace.TracerProvider) FS {
+	backend, bucket := backendName(fs)
+	attrs := []attribute.KeyValue{attribute.String("storage.backend", backend)}
+	if bucket != "" {
+		attrs = append(attrs, attribute.String("storage.bucket", bucket))
+	}
+
+	return &tracingWrapper{
+		fs:     fs,
+		tracer: tp.Tracer(tracerName),
+		attrs:  attrs,
+	}
+}
+
+// backendName returns the name of the backend of fs, and its bucket if any.
+func backendName(fs FS) (string, string) {
+	switch fs := fs.(type) {
+	case *memoryFS:
+		return "memory", ""
+	case *localFS:
+		return "local", ""
+	case *cloudStorageFS:
+		return "gcs", fs.bucketName
+	}
+
+	return fmt.Sprintf("%T", fs), ""
+}
+
+type tracingWrapper struct {
+	fs     FS
+	tracer trace.Tracer
+	attrs  []attribute.KeyValue
+}
+
+func (t *tracingWrapper) start(ctx context.Context, op Op, path string) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, "storage."+string(op),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.attrs...),
+		trace.WithAttributes(attribute.String("storage.path", path)),
+	)
+}
+
+// endSpan ends span, recording err.
+func endSpan(span trace.Span, err error) {
+	defer span.End()
+
+	if err == nil {
+		return
+	}
+	span.SetAttributes(attribute.String("storage.error_class", errorClass(err)))
+	if !IsNotExist(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Open implements FS.
+func (t *tracingWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	ctx, span := t.start(ctx, OpOpen, path)
+	f, err := t.fs.Open(ctx, path, options)
+	if err != nil {
+		endSpan(span, err)
+
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int64("storage.object.size", f.Size))
+
+	f.ReadCloser = &countingReadCloser{
+		ReadCloser: f.ReadCloser,
+		close: func(n int64, err error) error {
+			span.SetAttributes(attribute.Int64("storage.bytes", n))
+			endSpan(span, err)
+
+			return err
+		},
+	}
+
+	return f, nil
+}
+
+// Attributes implements FS.
+func (t *tracingWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	ctx, span := t.start(ctx, OpAttributes, path)
+	attrs, err := t.fs.Attributes(ctx, path, options)
+	if err == nil {
+		span.SetAttributes(attribute.Int64("storage.object.size", attrs.Size))
+	}
+	endSpan(span, err)
+
+	return attrs, err
+}
+
+// Create implements FS.
+func (t *tracingWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	ctx, span := t.start(ctx, OpCreate, path)
+	wc, err := t.fs.Create(ctx, path, options)
+	if err != nil {
+		endSpan(span, err)
+
+		return nil, err
+	}
+
+	return &countingWriteCloser{
+		WriteCloser: wc,
+		close: func(n int64, err error) error {
+			span.SetAttributes(attribute.Int64("storage.bytes", n))
+			endSpan(span, err)
+
+			return err
+		},
+	}, nil
+}
+
+// Delete implements FS.
+func (t *tracingWrapper) Delete(ctx context.Context, path string) error {
+	ctx, span := t.start(ctx, OpDelete, path)
+	err := t.fs.Delete(ctx, path)
+	endSpan(span, err)
+
+	return err
+}
+
+// Walk implements FS.
+func (t *tracingWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	ctx, span := t.start(ctx, OpWalk, path)
+	var entries int64
+	err := t.fs.Walk(ctx, path, func(path string) error {
+		entries++
+
+		return fn(path)
+	})
+	span.SetAttributes(attribute.Int64("storage.walk.entries", entries))
+	endSpan(span, err)
+
+	return err
+}
+
+// URL implements FS.
+func (t *tracingWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	ctx, span := t.start(ctx, OpURL, path)
+	url, err := t.fs.URL(ctx, path, options)
+	endSpan(span, err)
+
+	return url, err
+}
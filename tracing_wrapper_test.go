@@ -0,0 +1,89 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func withTracing(cb func(fs storage.FS, exporter *tracetest.InMemoryExporter, tp *sdktrace.TracerProvider)) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	withMem(func(mem storage.FS) {
+		cb(storage.NewTracingWrapper(mem, tp), exporter, tp)
+	})
+}
+
+func spanAttrs(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value, len(span.Attributes))
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+
+	return attrs
+}
+
+func TestTracingWrapper(t *testing.T) {
+	withTracing(func(fs storage.FS, _ *tracetest.InMemoryExporter, _ *sdktrace.TracerProvider) {
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+	})
+}
+
+func TestTracingWrapper_spans(t *testing.T) {
+	withTracing(func(fs storage.FS, exporter *tracetest.InMemoryExporter, tp *sdktrace.TracerProvider) {
+		ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+
+		w, err := fs.Create(ctx, "foo", nil)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("bar"))
+		require.NoError(t, err)
+		assert.Empty(t, exporter.GetSpans(), "the span ends on Close")
+		require.NoError(t, w.Close())
+
+		f, err := fs.Open(ctx, "foo", nil)
+		require.NoError(t, err)
+		buf := make([]byte, 2)
+		_, err = f.Read(buf)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		_, err = storage.List(ctx, fs, "")
+		require.NoError(t, err)
+		_, err = fs.URL(ctx, "foo", nil)
+		require.Error(t, err)
+		parent.End()
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 5)
+		for _, span := range spans[:4] {
+			assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+		}
+
+		create := spanAttrs(spans[0])
+		assert.Equal(t, "storage.create", spans[0].Name)
+		assert.Equal(t, "foo", create["storage.path"].AsString())
+		assert.Equal(t, "memory", create["storage.backend"].AsString())
+		assert.Equal(t, int64(3), create["storage.bytes"].AsInt64())
+
+		open := spanAttrs(spans[1])
+		assert.Equal(t, int64(3), open["storage.object.size"].AsInt64())
+		assert.Equal(t, int64(2), open["storage.bytes"].AsInt64())
+
+		assert.Equal(t, int64(1), spanAttrs(spans[2])["storage.walk.entries"].AsInt64())
+
+		assert.Equal(t, codes.Error, spans[3].Status.Code)
+		assert.Len(t, spans[3].Events, 1)
+	})
+}
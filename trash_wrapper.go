@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultTrashPrefix is the default prefix of the namespace where NewTrashWrapper moves deleted files.
+const DefaultTrashPrefix = ".trash/"
+
+// Metadata keys set on the files moved to the trash.
+const (
+	trashPathKey      = "trash-original-path"
+	trashDeletedAtKey = "trash-deleted-at"
+)
+
+// TrashOptions are used to configure NewTrashWrapper.
+type TrashOptions struct {
+	// Prefix is the prefix of the hidden namespace where deleted files are moved.
+	// Defaults to DefaultTrashPrefix.
+	Prefix string
+}
+
+// TrashEntry is a deleted file in the trash of a TrashWrapper.
+type TrashEntry struct {
+	// Path is the original path of the file.
+	Path string
+	// DeletedAt is the time at which the file was deleted.
+	DeletedAt time.Time
+	Attributes
+}
+
+// NewTrashWrapper creates an FS which moves deleted files to a hidden trash namespace of fs, from which
+// they can be restored with Undelete until they are purged.
+//
+// The trash isn't visible through the wrapper: it is skipped by Walk, and its paths don't exist for other
+// operations.  Deleted files are copied along with their original path and deletion time in their metadata.
+// A path can be deleted several times, Undelete restores the most recent deletion.
+func NewTrashWrapper(fs FS, options *TrashOptions) *TrashWrapper {
+	if options == nil {
+		options = &TrashOptions{}
+	}
+	prefix := options.Prefix
+	if prefix == "" {
+		prefix = DefaultTrashPrefix
+	}
+
+	return &TrashWrapper{
+		fs:     fs,
+		prefix: prefix,
+	}
+}
+
+// TrashWrapper is an FS which moves deleted files to a trash.
+type TrashWrapper struct {
+	fs     FS
+	prefix string
+}
+
+func (t *TrashWrapper) isHidden(path string) bool {
+	return hasPathPrefix(path, t.prefix)
+}
+
+func (t *TrashWrapper) trashPath(path string) string {
+	return t.prefix + strings.TrimPrefix(path, "/") + "/"
+}
+
+// ListTrash returns the files in the trash, the most recently deleted first for each path.
+func (t *TrashWrapper) ListTrash(ctx context.Context) ([]TrashEntry, error) {
+	var entries []TrashEntry
+	err := t.walkTrash(ctx, func(path string, deletedAt time.Time, trashPath string) error {
+		attrs, err := t.fs.Attributes(ctx, trashPath, nil)
+		if err != nil {
+			if IsNotExist(err) {
+				return nil // Purged concurrently
+			}
+
+			return err
+		}
+		entries = append(entries, TrashEntry{Path: path, DeletedAt: deletedAt, Attributes: *attrs})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// walkTrash calls fn with the original path, deletion time and path in the trash of each deleted file.
+func (t *TrashWrapper) walkTrash(ctx context.Context, fn func(path string, deletedAt time.Time, trashPath string) error) error {
+	var paths []string
+	if err := t.fs.Walk(ctx, t.prefix, func(p string) error {
+		paths = append(paths, p)
+
+		return nil
+	}); err != nil && !IsNotExist(err) && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// Group the deletions of each path, as listIDs sorts them
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		p = strings.TrimPrefix(strings.TrimPrefix(p, "/"), t.prefix)
+		i := strings.LastIndex(p, "/")
+		if i < 0 || seen[p[:i]] {
+			continue
+		}
+		path := p[:i]
+		seen[path] = true
+
+		ids, err := listIDs(ctx, t.fs, t.trashPath(path))
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			deletedAt, _ := time.Parse(versionIDLayout, id)
+			if err := fn(path, deletedAt, t.trashPath(path)+id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Undelete restores the most recently deleted file at path.  It fails with an error satisfying IsExist if
+// path exists.
+func (t *TrashWrapper) Undelete(ctx context.Context, path string) error {
+	if t.isHidden(path) {
+		return &notExistError{Path: path}
+	}
+
+	ids, err := listIDs(ctx, t.fs, t.trashPath(path))
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return &notExistError{Path: path}
+	}
+
+	trashPath := t.trashPath(path) + ids[0]
+	if err := copyFileOptions(ctx, t.fs, trashPath, path, func(options *WriterOptions) {
+		delete(options.Attributes.Metadata, trashPathKey)
+		delete(options.Attributes.Metadata, trashDeletedAtKey)
+		options.IfNotExist = true
+	}); err != nil {
+		return err
+	}
+
+	return t.fs.Delete(ctx, trashPath)
+}
+
+// Purge permanently deletes the files deleted more than olderThan ago.
+func (t *TrashWrapper) Purge(ctx context.Context, olderThan time.Duration) error {
+	now := time.Now()
+
+	return t.walkTrash(ctx, func(_ string, deletedAt time.Time, trashPath string) error {
+		if now.Sub(deletedAt) < olderThan {
+			return nil
+		}
+		if err := t.fs.Delete(ctx, trashPath); err != nil && !IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Open implements FS.
+func (t *TrashWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	if t.isHidden(path) {
+		return nil, &notExistError{Path: path}
+	}
+
+	return t.fs.Open(ctx, path, options)
+}
+
+// Attributes implements FS.
+func (t *TrashWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	if t.isHidden(path) {
+		return nil, &notExistError{Path: path}
+	}
+
+	return t.fs.Attributes(ctx, path, options)
+}
+
+// Create implements FS.
+func (t *TrashWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	if t.isHidden(path) {
+		return nil, fmt.Errorf("storage %s: cannot create a file in the trash", path)
+	}
+
+	return t.fs.Create(ctx, path, options)
+}
+
+// Delete implements FS.  The file is moved to the trash, or each file of the directory for a directory of
+// localFS.
+func (t *TrashWrapper) Delete(ctx context.Context, path string) error {
+	if t.isHidden(path) {
+		return &notExistError{Path: path}
+	}
+
+	err := t.copyToTrash(ctx, path)
+	if errors.Is(err, syscall.EISDIR) {
+		// The files of the directory are deleted along with it
+		var paths []string
+		err = t.fs.Walk(ctx, strings.TrimSuffix(path, "/")+"/", func(p string) error {
+			paths = append(paths, strings.TrimPrefix(p, "/"))
+
+			return nil
+		})
+		for i := 0; err == nil && i < len(paths); i++ {
+			err = t.copyToTrash(ctx, paths[i])
+		}
+	}
+	if err != nil && !IsNotExist(err) {
+		return err
+	}
+
+	return t.fs.Delete(ctx, path)
+}
+
+// copyToTrash copies the file at path to the trash.
+func (t *TrashWrapper) copyToTrash(ctx context.Context, path string) error {
+	deletedAt := time.Now().UTC()
+
+	return copyFile(ctx, t.fs, path, t.trashPath(path)+deletedAt.Format(versionIDLayout), func(m map[string]string) {
+		m[trashPathKey] = path
+		m[trashDeletedAtKey] = deletedAt.Format(time.RFC3339Nano)
+	})
+}
+
+// Walk implements FS.  The trash is skipped.
+func (t *TrashWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	return t.fs.Walk(ctx, path, func(path string) error {
+		if t.isHidden(path) {
+			return nil
+		}
+
+		return fn(path)
+	})
+}
+
+func (t *TrashWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	if t.isHidden(path) {
+		return "", &notExistError{Path: path}
+	}
+
+	return t.fs.URL(ctx, path, options)
+}
@@ -0,0 +1,105 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func TestTrashWrapper(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		fs := storage.NewTrashWrapper(mem, nil)
+		testutils.Create(t, fs, "foo", "")
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+	})
+}
+
+func TestTrashWrapper_Undelete(t *testing.T) {
+	ctx := context.Background()
+
+	check := func(mem storage.FS) {
+		fs := storage.NewTrashWrapper(mem, nil)
+		require.NoError(t, storage.Write(ctx, fs, "dir/foo", []byte("v1"), nil))
+		require.NoError(t, fs.Delete(ctx, "dir/foo"))
+		require.NoError(t, storage.Write(ctx, fs, "dir/foo", []byte("v2"), nil))
+		require.NoError(t, fs.Delete(ctx, "dir/foo"))
+
+		// The trash is hidden
+		testutils.OpenNotExists(t, fs, "dir/foo")
+		paths, err := storage.List(ctx, fs, "")
+		require.NoError(t, err)
+		assert.Empty(t, paths)
+
+		entries, err := fs.ListTrash(ctx)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "dir/foo", entries[0].Path)
+		assert.True(t, entries[0].DeletedAt.After(entries[1].DeletedAt))
+
+		// The most recent deletion is restored
+		require.NoError(t, fs.Undelete(ctx, "dir/foo"))
+		testutils.OpenExists(t, fs, "dir/foo", "v2")
+
+		assert.True(t, storage.IsExist(fs.Undelete(ctx, "dir/foo")))
+
+		entries, err = fs.ListTrash(ctx)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		assert.True(t, storage.IsNotExist(fs.Undelete(ctx, "bar")))
+	}
+
+	withMem(check)
+	withLocal(check)
+}
+
+func TestTrashWrapper_Purge(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		fs := storage.NewTrashWrapper(mem, nil)
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("foo"), nil))
+		require.NoError(t, fs.Delete(ctx, "foo"))
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(t, storage.Write(ctx, fs, "bar", []byte("bar"), nil))
+		require.NoError(t, fs.Delete(ctx, "bar"))
+
+		require.NoError(t, fs.Purge(ctx, 25*time.Millisecond))
+
+		entries, err := fs.ListTrash(ctx)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "bar", entries[0].Path)
+
+		require.NoError(t, fs.Purge(ctx, 0))
+		entries, err = fs.ListTrash(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestTrashWrapper_Delete_directory(t *testing.T) {
+	ctx := context.Background()
+
+	withLocal(func(local storage.FS) {
+		fs := storage.NewTrashWrapper(local, nil)
+		require.NoError(t, storage.Write(ctx, fs, "dir/foo", []byte("foo"), nil))
+		require.NoError(t, storage.Write(ctx, fs, "dir/sub/bar", []byte("bar"), nil))
+		require.NoError(t, fs.Delete(ctx, "dir"))
+
+		testutils.OpenNotExists(t, fs, "dir/foo")
+		entries, err := fs.ListTrash(ctx)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+
+		require.NoError(t, fs.Undelete(ctx, "dir/sub/bar"))
+		testutils.OpenExists(t, fs, "dir/sub/bar", "bar")
+	})
+}
@@ -49,8 +49,78 @@ func Write(ctx context.Context, fs FS, path string, data []byte, options *Writer
 	return nil
 }
 
+// AbortWrite aborts a write started with Create, e.g. when reading the content to write fails.
+// cancel must cancel the context passed to Create: it is cancelled before closing w, so the resources
+// of w are released without writing the file.
+func AbortWrite(cancel context.CancelFunc, w io.WriteCloser) {
+	cancel()
+	_ = w.Close()
+}
+
 func Exists(ctx context.Context, fs FS, path string) bool {
 	attrs, _ := fs.Attributes(ctx, path, nil)
 
 	return attrs != nil
 }
+
+// copyFile copies the content and attributes of src to dst, without decompressing it.
+// If not nil, editMetadata can modify a copy of the metadata of src.
+func copyFile(ctx context.Context, fs FS, src, dst string, editMetadata func(map[string]string)) error {
+	var edit func(*WriterOptions)
+	if editMetadata != nil {
+		edit = func(options *WriterOptions) {
+			editMetadata(options.Attributes.Metadata)
+		}
+	}
+
+	return copyFileOptions(ctx, fs, src, dst, edit)
+}
+
+// copyFileOptions is like copyFile, but edit can modify the WriterOptions of dst, with a copy of the
+// metadata of src.
+func copyFileOptions(ctx context.Context, fs FS, src, dst string, edit func(*WriterOptions)) error {
+	// Open doesn't return the metadata on all FS
+	attrs, err := fs.Attributes(ctx, src, &ReaderOptions{ReadCompressed: true})
+	if err != nil {
+		return err
+	}
+
+	f, err := fs.Open(ctx, src, &ReaderOptions{ReadCompressed: true})
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	m := make(map[string]string, len(attrs.Metadata))
+	for k, v := range attrs.Metadata {
+		m[k] = v
+	}
+	options := &WriterOptions{
+		Attributes: Attributes{
+			ContentType:     attrs.ContentType,
+			ContentEncoding: attrs.ContentEncoding,
+			Metadata:        m,
+			MD5:             attrs.MD5,
+			CRC32C:          attrs.CRC32C,
+		},
+	}
+	if edit != nil {
+		edit(options)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w, err := fs.Create(ctx, dst, options)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, f); err != nil {
+		AbortWrite(cancel, w)
+
+		return err
+	}
+
+	return w.Close()
+}
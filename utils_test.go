@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/Shopify/go-storage"
 	"github.com/Shopify/go-storage/internal/testutils"
@@ -38,3 +39,48 @@ func TestWrite(t *testing.T) {
 		testutils.OpenExists(t, fs, "foo", "bar")
 	})
 }
+
+func TestWrite_IfNotExist(t *testing.T) {
+	ctx := context.Background()
+	options := &storage.WriterOptions{IfNotExist: true}
+
+	check := func(fs storage.FS) {
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("first"), options))
+		err := storage.Write(ctx, fs, "foo", []byte("second"), options)
+		assert.True(t, storage.IsExist(err))
+		testutils.OpenExists(t, fs, "foo", "first")
+
+		// The path is created by another writer after Create, the check is atomic on Close
+		w, err := fs.Create(ctx, "bar", options)
+		require.NoError(t, err)
+		require.NoError(t, storage.Write(ctx, fs, "bar", []byte("first"), nil))
+		_, err = w.Write([]byte("second"))
+		require.NoError(t, err)
+		assert.True(t, storage.IsExist(w.Close()))
+		testutils.OpenExists(t, fs, "bar", "first")
+	}
+
+	withMem(check)
+	withLocal(check)
+}
+
+func TestAbortWrite(t *testing.T) {
+	check := func(fs storage.FS) {
+		testutils.Create(t, fs, "foo", "bar")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		w, err := fs.Create(ctx, "foo", nil)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("partial"))
+		require.NoError(t, err)
+		storage.AbortWrite(cancel, w)
+
+		testutils.OpenExists(t, fs, "foo", "bar")
+		list, err := storage.List(context.Background(), fs, "")
+		require.NoError(t, err)
+		assert.Len(t, list, 1, "no temporary file must be left")
+	}
+
+	withMem(check)
+	withLocal(check)
+}
@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultVersionsPrefix is the default prefix of the namespace where NewVersioningWrapper keeps
+// the prior versions of files.
+const DefaultVersionsPrefix = ".versions/"
+
+// versionIDLayout sorts chronologically, so versions can be sorted by ID.
+const versionIDLayout = "20060102T150405.000000000Z"
+
+// ErrInvalidVersion is returned when a version ID is malformed.
+var ErrInvalidVersion = errors.New("invalid version")
+
+// VersioningOptions are used to configure NewVersioningWrapper.
+type VersioningOptions struct {
+	// Prefix is the prefix of the hidden namespace where the versions are stored.
+	// Defaults to DefaultVersionsPrefix.
+	Prefix string
+
+	// MaxVersions is the maximum number of prior versions kept per path, the oldest are pruned first.
+	// If 0, the number of versions isn't limited.
+	MaxVersions int
+	// MaxAge is the maximum age of the prior versions kept.  If 0, versions don't expire.
+	MaxAge time.Duration
+
+	// Clock is used for the version IDs and MaxAge.  Defaults to the system clock.
+	Clock Clock
+}
+
+// Version is a prior version of a file kept by a VersioningWrapper.
+type Version struct {
+	// ID identifies the version, it is the time at which the version was replaced.
+	ID string
+	Attributes
+}
+
+// NewVersioningWrapper creates an FS which keeps the prior versions of each path in a hidden namespace
+// of fs, so overwritten or deleted files can be restored.  The versions are regular files, so it works with
+// any FS, including buckets without native object versioning.
+//
+// The current content of a path is kept as a version when Create or Delete is called on it.  The hidden
+// namespace isn't visible through the wrapper: it is skipped by Walk, and its paths don't exist for other
+// operations.
+//
+// Versions are pruned according to the retention options every time a new version is kept.
+func NewVersioningWrapper(fs FS, options *VersioningOptions) *VersioningWrapper {
+	if options == nil {
+		options = &VersioningOptions{}
+	}
+	prefix := options.Prefix
+	if prefix == "" {
+		prefix = DefaultVersionsPrefix
+	}
+
+	return &VersioningWrapper{
+		fs:      fs,
+		prefix:  prefix,
+		options: options,
+		clock:   clockOrDefault(options.Clock),
+	}
+}
+
+// VersioningWrapper is an FS which keeps prior versions of files.
+type VersioningWrapper struct {
+	fs      FS
+	prefix  string
+	options *VersioningOptions
+	clock   Clock
+}
+
+func (v *VersioningWrapper) isHidden(path string) bool {
+	return hasPathPrefix(path, v.prefix)
+}
+
+// hasPathPrefix returns whether path starts with prefix, ignoring the leading "/" of paths walked on localFS.
+func hasPathPrefix(path, prefix string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(path, "/"), prefix)
+}
+
+func (v *VersioningWrapper) versionsPath(path string) string {
+	return v.prefix + strings.TrimPrefix(path, "/") + "/"
+}
+
+func (v *VersioningWrapper) versionPath(path string, id string) (string, error) {
+	if _, err := time.Parse(versionIDLayout, id); err != nil {
+		return "", fmt.Errorf("storage %s: %w: %q", path, ErrInvalidVersion, id)
+	}
+
+	return v.versionsPath(path) + id, nil
+}
+
+// keep copies the current content of path as a new version, if it exists.
+func (v *VersioningWrapper) keep(ctx context.Context, path string) error {
+	id := v.clock.Now().UTC().Format(versionIDLayout)
+	if err := copyFile(ctx, v.fs, path, v.versionsPath(path)+id, nil); err != nil && !IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// prune deletes the versions of path not satisfying the retention options.
+func (v *VersioningWrapper) prune(ctx context.Context, path string) error {
+	if v.options.MaxVersions == 0 && v.options.MaxAge == 0 {
+		return nil
+	}
+
+	ids, err := v.versionIDs(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	now := v.clock.Now()
+	for i, id := range ids {
+		t, _ := time.Parse(versionIDLayout, id)
+		expired := v.options.MaxAge > 0 && now.Sub(t) > v.options.MaxAge
+		if !expired && (v.options.MaxVersions == 0 || i < v.options.MaxVersions) {
+			continue
+		}
+
+		if err := v.fs.Delete(ctx, v.versionsPath(path)+id); err != nil && !IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// versionIDs returns the IDs of the versions of path, the most recent first.
+func (v *VersioningWrapper) versionIDs(ctx context.Context, path string) ([]string, error) {
+	return listIDs(ctx, v.fs, v.versionsPath(path))
+}
+
+// listIDs returns the IDs of the files directly under dir, the most recent first.
+// IDs are times formatted with versionIDLayout, other files are skipped.
+func listIDs(ctx context.Context, fs FS, dir string) ([]string, error) {
+	var ids []string
+	err := fs.Walk(ctx, dir, func(p string) error {
+		id := strings.TrimPrefix(strings.TrimPrefix(p, "/"), dir)
+		// Skip the files of the paths nested under dir
+		if _, err := time.Parse(versionIDLayout, id); err == nil {
+			ids = append(ids, id)
+		}
+
+		return nil
+	})
+	if err != nil && !IsNotExist(err) && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	return ids, nil
+}
+
+// ListVersions returns the prior versions of path, the most recent first.
+func (v *VersioningWrapper) ListVersions(ctx context.Context, path string) ([]Version, error) {
+	ids, err := v.versionIDs(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]Version, 0, len(ids))
+	for _, id := range ids {
+		attrs, err := v.fs.Attributes(ctx, v.versionsPath(path)+id, nil)
+		if err != nil {
+			if IsNotExist(err) {
+				continue // Pruned concurrently
+			}
+
+			return nil, err
+		}
+		versions = append(versions, Version{ID: id, Attributes: *attrs})
+	}
+
+	return versions, nil
+}
+
+// OpenVersion opens the version id of path.
+func (v *VersioningWrapper) OpenVersion(ctx context.Context, path string, id string, options *ReaderOptions) (*File, error) {
+	p, err := v.versionPath(path, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.fs.Open(ctx, p, options)
+}
+
+// Restore replaces the content of path with the version id.  The replaced content is kept as a new version.
+func (v *VersioningWrapper) Restore(ctx context.Context, path string, id string) error {
+	p, err := v.versionPath(path, id)
+	if err != nil {
+		return err
+	}
+	if err := v.keep(ctx, path); err != nil {
+		return err
+	}
+	// Pruning after copying, as the restored version may be pruned
+	if err := copyFile(ctx, v.fs, p, path, nil); err != nil {
+		return err
+	}
+
+	return v.prune(ctx, path)
+}
+
+// Open implements FS.
+func (v *VersioningWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	if v.isHidden(path) {
+		return nil, &notExistError{Path: path}
+	}
+
+	return v.fs.Open(ctx, path, options)
+}
+
+// Attributes implements FS.
+func (v *VersioningWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	if v.isHidden(path) {
+		return nil, &notExistError{Path: path}
+	}
+
+	return v.fs.Attributes(ctx, path, options)
+}
+
+// Create implements FS.  The current content of path is kept as a version before creating the writer.
+func (v *VersioningWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	if v.isHidden(path) {
+		return nil, fmt.Errorf("storage %s: cannot create a file in the versions namespace", path)
+	}
+	if err := v.keep(ctx, path); err != nil {
+		return nil, err
+	}
+	if err := v.prune(ctx, path); err != nil {
+		return nil, err
+	}
+
+	return v.fs.Create(ctx, path, options)
+}
+
+// Delete implements FS.  The current content of path is kept as a version, so it can be restored.
+func (v *VersioningWrapper) Delete(ctx context.Context, path string) error {
+	if v.isHidden(path) {
+		return &notExistError{Path: path}
+	}
+	if err := v.keep(ctx, path); err != nil {
+		return err
+	}
+	if err := v.prune(ctx, path); err != nil {
+		return err
+	}
+
+	return v.fs.Delete(ctx, path)
+}
+
+// Walk implements FS.  The versions are skipped.
+func (v *VersioningWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	return v.fs.Walk(ctx, path, func(path string) error {
+		if v.isHidden(path) {
+			return nil
+		}
+
+		return fn(path)
+	})
+}
+
+func (v *VersioningWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	if v.isHidden(path) {
+		return "", &notExistError{Path: path}
+	}
+
+	return v.fs.URL(ctx, path, options)
+}
@@ -0,0 +1,133 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func readVersion(t *testing.T, fs *storage.VersioningWrapper, path, id string) string {
+	t.Helper()
+
+	f, err := fs.OpenVersion(context.Background(), path, id, nil)
+	require.NoError(t, err)
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestVersioningWrapper(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		fs := storage.NewVersioningWrapper(mem, nil)
+		testutils.Create(t, fs, "foo", "")
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "foo")
+	})
+}
+
+func TestVersioningWrapper_Restore(t *testing.T) {
+	ctx := context.Background()
+
+	check := func(mem storage.FS) {
+		fs := storage.NewVersioningWrapper(mem, nil)
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("v1"), &storage.WriterOptions{
+			Attributes: storage.Attributes{ContentType: "text/plain"},
+		}))
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("v2"), nil))
+		require.NoError(t, storage.Write(ctx, fs, "foobar", []byte("other"), nil))
+		require.NoError(t, fs.Delete(ctx, "foo"))
+
+		versions, err := fs.ListVersions(ctx, "foo")
+		require.NoError(t, err)
+		require.Len(t, versions, 2)
+
+		assert.Equal(t, "v2", readVersion(t, fs, "foo", versions[0].ID))
+		assert.Equal(t, "v1", readVersion(t, fs, "foo", versions[1].ID))
+
+		// The versions are hidden
+		paths, err := storage.List(ctx, fs, "")
+		require.NoError(t, err)
+		assert.Len(t, paths, 1)
+		assert.Contains(t, paths[0], "foobar")
+
+		require.NoError(t, fs.Restore(ctx, "foo", versions[1].ID))
+		data, err := storage.Read(ctx, fs, "foo", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(data))
+
+		versions, err = fs.ListVersions(ctx, "foo")
+		require.NoError(t, err)
+		assert.Len(t, versions, 2, "nothing to keep as the path was deleted")
+
+		_, err = fs.OpenVersion(ctx, "foo", "../foo", nil)
+		assert.ErrorIs(t, err, storage.ErrInvalidVersion)
+	}
+
+	withMem(check)
+	withLocal(check)
+}
+
+func TestVersioningWrapper_retention(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		fs := storage.NewVersioningWrapper(mem, &storage.VersioningOptions{MaxVersions: 2})
+		for _, content := range []string{"v1", "v2", "v3", "v4"} {
+			require.NoError(t, storage.Write(ctx, fs, "foo", []byte(content), &storage.WriterOptions{
+				Attributes: storage.Attributes{ContentType: "text/plain"},
+			}))
+		}
+
+		versions, err := fs.ListVersions(ctx, "foo")
+		require.NoError(t, err)
+		require.Len(t, versions, 2)
+		assert.Equal(t, "text/plain", versions[0].ContentType)
+		assert.Equal(t, "v3", readVersion(t, fs, "foo", versions[0].ID))
+		assert.Equal(t, "v2", readVersion(t, fs, "foo", versions[1].ID))
+	})
+
+	withMem(func(mem storage.FS) {
+		clock := testutils.NewFakeClock(time.Now())
+		fs := storage.NewVersioningWrapper(mem, &storage.VersioningOptions{MaxAge: time.Minute, Clock: clock})
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("v1"), nil))
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("v2"), nil))
+		clock.Advance(time.Hour)
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("v3"), nil))
+
+		versions, err := fs.ListVersions(ctx, "foo")
+		require.NoError(t, err)
+		require.Len(t, versions, 1)
+		assert.Equal(t, clock.Now().UTC().Format("20060102T150405.000000000Z"), versions[0].ID)
+		assert.Equal(t, "v2", readVersion(t, fs, "foo", versions[0].ID))
+	})
+}
+
+func TestVersioningWrapper_failedCopy(t *testing.T) {
+	ctx := context.Background()
+
+	check := func(base storage.FS) {
+		require.NoError(t, storage.Write(ctx, base, "foo", []byte("v1"), nil))
+		fs := storage.NewVersioningWrapper(&failingReadFS{base}, nil)
+
+		// Keeping the current content as a version fails, no partial version is left behind
+		_, err := fs.Create(ctx, "foo", nil)
+		assert.ErrorIs(t, err, errReadFailed)
+
+		paths, err := storage.List(ctx, base, "")
+		require.NoError(t, err)
+		assert.Len(t, paths, 1)
+	}
+
+	withMem(check)
+	withLocal(check)
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Metadata keys controlling the deletion of files written through NewWORMWrapper.
+const (
+	// WORMRetainUntilKey is the metadata key of the time, formatted with time.RFC3339, until which a file
+	// cannot be deleted.
+	WORMRetainUntilKey = "worm-retain-until"
+	// WORMLegalHoldKey is the metadata key of the legal hold flag.  A file cannot be deleted while it is "true".
+	WORMLegalHoldKey = "worm-legal-hold"
+)
+
+// ErrObjectLocked is returned (wrapped in a *LockedError) when deleting a file which is retained.
+var ErrObjectLocked = errors.New("object is locked")
+
+// LockedError is returned when deleting a file which is under retention or legal hold.
+// It wraps ErrObjectLocked.
+type LockedError struct {
+	Path string
+	// RetainUntil is the time until which the file is retained, if any.
+	RetainUntil time.Time
+	// LegalHold is set if the file is under legal hold.
+	LegalHold bool
+}
+
+// Error implements error
+func (e *LockedError) Error() string {
+	if e.LegalHold {
+		return fmt.Sprintf("storage %v: %v: legal hold", e.Path, ErrObjectLocked)
+	}
+
+	return fmt.Sprintf("storage %v: %v: retained until %v", e.Path, ErrObjectLocked, e.RetainUntil.Format(time.RFC3339))
+}
+
+// Unwrap returns ErrObjectLocked.
+func (e *LockedError) Unwrap() error { return ErrObjectLocked }
+
+// errMetadataNotPersisted is wrapped by the errors returned when the metadata controlling the deletion of a
+// file is not stored by the FS.
+func errMetadataNotPersisted(path string) error {
+	return fmt.Errorf("storage %s: %w: the FS doesn't persist metadata", path, ErrNotImplemented)
+}
+
+// WORMOptions are used to configure NewWORMWrapper.
+type WORMOptions struct {
+	// Retention is the duration for which new files cannot be deleted, unless their WORMRetainUntilKey
+	// metadata is set by the caller.  If 0, files without WORMRetainUntilKey can be deleted, otherwise
+	// they cannot.
+	Retention time.Duration
+}
+
+// NewWORMWrapper creates a write-once-read-many FS: files cannot be overwritten, and cannot be deleted
+// while they are retained.
+//
+// Create fails with an error satisfying IsExist if the path exists.  The check is atomic with the write
+// using WriterOptions.IfNotExist, and is also done before creating the writer for FS ignoring it.
+//
+// Delete fails with a *LockedError until the time in the WORMRetainUntilKey metadata of the file, or
+// while its WORMLegalHoldKey metadata is "true".  The retention is set on Create, either by the caller or
+// from the options.  The legal hold can be set on Create, and placed or released later with SetLegalHold.
+// Directories, e.g. of localFS, cannot be deleted.
+//
+// The wrapper fails closed on FS which don't persist metadata, like localFS: closing the writer of a file
+// with retention or legal hold fails with an error wrapping ErrNotImplemented, and its Delete fails.
+func NewWORMWrapper(fs FS, options *WORMOptions) FS {
+	if options == nil {
+		options = &WORMOptions{}
+	}
+
+	return &wormWrapper{
+		fs:      fs,
+		options: options,
+	}
+}
+
+type wormWrapper struct {
+	fs      FS
+	options *WORMOptions
+}
+
+// Open implements FS.
+func (w *wormWrapper) Open(ctx context.Context, path string, options *ReaderOptions) (*File, error) {
+	return w.fs.Open(ctx, path, options)
+}
+
+// Attributes implements FS.
+func (w *wormWrapper) Attributes(ctx context.Context, path string, options *ReaderOptions) (*Attributes, error) {
+	return w.fs.Attributes(ctx, path, options)
+}
+
+// Create implements FS.
+func (w *wormWrapper) Create(ctx context.Context, path string, options *WriterOptions) (io.WriteCloser, error) {
+	if Exists(ctx, w.fs, path) {
+		return nil, &existError{Path: path}
+	}
+
+	// Don't modify the options of the caller
+	wormOptions := &WriterOptions{}
+	if options != nil {
+		*wormOptions = *options
+	}
+	wormOptions.IfNotExist = true
+
+	if _, ok := wormOptions.Attributes.Metadata[WORMRetainUntilKey]; !ok && w.options.Retention > 0 {
+		metadata := make(map[string]string, len(wormOptions.Attributes.Metadata)+1)
+		for k, v := range wormOptions.Attributes.Metadata {
+			metadata[k] = v
+		}
+		metadata[WORMRetainUntilKey] = time.Now().Add(w.options.Retention).UTC().Format(time.RFC3339Nano)
+		wormOptions.Attributes.Metadata = metadata
+	}
+
+	wc, err := w.fs.Create(ctx, path, wormOptions)
+	if err != nil {
+		return nil, err
+	}
+	_, retained := wormOptions.Attributes.Metadata[WORMRetainUntilKey]
+	_, held := wormOptions.Attributes.Metadata[WORMLegalHoldKey]
+	if !retained && !held {
+		return wc, nil
+	}
+
+	return &wormWriter{
+		WriteCloser: wc,
+		ctx:         ctx,
+		fs:          w.fs,
+		path:        path,
+		metadata:    wormOptions.Attributes.Metadata,
+	}, nil
+}
+
+// wormWriter checks on Close that the metadata controlling the deletion of the file was persisted.
+type wormWriter struct {
+	io.WriteCloser
+
+	ctx      context.Context
+	fs       FS
+	path     string
+	metadata map[string]string
+}
+
+// Close implements io.Closer.
+func (w *wormWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+
+	return checkMetadata(w.ctx, w.fs, w.path, w.metadata)
+}
+
+// checkMetadata returns an error if the WORM metadata of path doesn't match metadata.
+func checkMetadata(ctx context.Context, fs FS, path string, metadata map[string]string) error {
+	attrs, err := fs.Attributes(ctx, path, nil)
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{WORMRetainUntilKey, WORMLegalHoldKey} {
+		if attrs.Metadata[key] != metadata[key] {
+			return errMetadataNotPersisted(path)
+		}
+	}
+
+	return nil
+}
+
+// Delete implements FS.
+func (w *wormWrapper) Delete(ctx context.Context, path string) error {
+	isDir, err := hasFiles(ctx, w.fs, strings.TrimSuffix(path, "/")+"/")
+	if err != nil {
+		return err
+	}
+	if isDir {
+		return fmt.Errorf("storage %s: %w: cannot delete a directory", path, ErrObjectLocked)
+	}
+
+	attrs, err := w.fs.Attributes(ctx, path, nil)
+	if err != nil {
+		if IsNotExist(err) {
+			return w.fs.Delete(ctx, path)
+		}
+
+		return err
+	}
+
+	if attrs.Metadata[WORMLegalHoldKey] == "true" {
+		return &LockedError{Path: path, LegalHold: true}
+	}
+	if v, ok := attrs.Metadata[WORMRetainUntilKey]; ok {
+		retainUntil, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			// Fail safe, the file may be retained
+			return fmt.Errorf("storage %s: invalid %s metadata: %w", path, WORMRetainUntilKey, err)
+		}
+		if time.Now().Before(retainUntil) {
+			return &LockedError{Path: path, RetainUntil: retainUntil}
+		}
+	} else if w.options.Retention > 0 {
+		// Fail safe, the retention may not have been persisted
+		return fmt.Errorf("storage %s: %w: no %s metadata", path, ErrObjectLocked, WORMRetainUntilKey)
+	}
+
+	return w.fs.Delete(ctx, path)
+}
+
+// errFileFound stops the Walk of hasFiles.
+var errFileFound = errors.New("file found")
+
+// hasFiles returns whether there is any file under the directory path.
+func hasFiles(ctx context.Context, fs FS, path string) (bool, error) {
+	err := fs.Walk(ctx, path, func(string) error {
+		return errFileFound
+	})
+	switch {
+	case errors.Is(err, errFileFound):
+		return true, nil
+	case err == nil, IsNotExist(err), errors.Is(err, os.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+		// localFS fails walking missing directories or files
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Walk implements FS.
+func (w *wormWrapper) Walk(ctx context.Context, path string, fn WalkFn) error {
+	return w.fs.Walk(ctx, path, fn)
+}
+
+// URL implements FS.  Only GET URLs are allowed, since others would bypass the checks.
+func (w *wormWrapper) URL(ctx context.Context, path string, options *SignedURLOptions) (string, error) {
+	if options != nil && options.Method != "" && !strings.EqualFold(options.Method, http.MethodGet) {
+		return "", fmt.Errorf("storage %s: %w: %s URL", path, ErrObjectLocked, options.Method)
+	}
+
+	return w.fs.URL(ctx, path, options)
+}
+
+// SetLegalHold places or releases the legal hold of a file written through a WORM wrapper, by setting or
+// removing its WORMLegalHoldKey metadata.  fs is the FS underlying the WORM wrapper, which rejects overwriting
+// files.
+//
+// The metadata is updated in place on Google Cloud Storage and MemoryFS.  Other FS rewrite the file through
+// a temporary copy, so its ModTime changes.  It fails with an error wrapping ErrNotImplemented if fs doesn't
+// persist the metadata, like localFS.
+func SetLegalHold(ctx context.Context, fs FS, path string, hold bool) error {
+	var metadata map[string]string
+	err := updateMetadata(ctx, fs, path, func(m map[string]string) {
+		if hold {
+			m[WORMLegalHoldKey] = "true"
+		} else {
+			delete(m, WORMLegalHoldKey)
+		}
+		metadata = m
+	})
+	if err != nil {
+		return err
+	}
+
+	return checkMetadata(ctx, fs, path, metadata)
+}
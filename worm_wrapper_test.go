@@ -0,0 +1,181 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Shopify/go-storage"
+	"github.com/Shopify/go-storage/internal/testutils"
+)
+
+func TestWORMWrapper(t *testing.T) {
+	withMem(func(mem storage.FS) {
+		fs := storage.NewWORMWrapper(mem, nil)
+		testutils.Create(t, fs, "foo", "bar")
+		testutils.Delete(t, fs, "baz")
+	})
+}
+
+func TestWORMWrapper_Create(t *testing.T) {
+	ctx := context.Background()
+
+	check := func(mem storage.FS) {
+		fs := storage.NewWORMWrapper(mem, nil)
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), nil))
+
+		err := storage.Write(ctx, fs, "foo", []byte("baz"), nil)
+		assert.True(t, storage.IsExist(err))
+		testutils.OpenExists(t, fs, "foo", "bar")
+	}
+
+	withMem(check)
+	withLocal(check)
+}
+
+func TestWORMWrapper_Create_concurrent(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		fs := storage.NewWORMWrapper(mem, nil)
+
+		// The path is created by another writer after Create, the write is rejected by the memoryFS
+		w, err := fs.Create(ctx, "foo", nil)
+		require.NoError(t, err)
+		require.NoError(t, storage.Write(ctx, mem, "foo", []byte("first"), nil))
+		_, err = w.Write([]byte("second"))
+		require.NoError(t, err)
+		assert.True(t, storage.IsExist(w.Close()))
+		testutils.OpenExists(t, fs, "foo", "first")
+	})
+
+	withLocal(func(local storage.FS) {
+		// The localFS links the file exclusively on Close
+		w, err := local.Create(ctx, "foo", &storage.WriterOptions{IfNotExist: true})
+		require.NoError(t, err)
+		require.NoError(t, storage.Write(ctx, local, "foo", []byte("first"), &storage.WriterOptions{IfNotExist: true}))
+		_, err = w.Write([]byte("second"))
+		require.NoError(t, err)
+		assert.True(t, storage.IsExist(w.Close()))
+		testutils.OpenExists(t, local, "foo", "first")
+
+		_, err = local.Create(ctx, "foo", &storage.WriterOptions{IfNotExist: true})
+		assert.True(t, storage.IsExist(err))
+	})
+}
+
+func TestWORMWrapper_Delete(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		fs := storage.NewWORMWrapper(mem, &storage.WORMOptions{Retention: 50 * time.Millisecond})
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), nil))
+
+		err := fs.Delete(ctx, "foo")
+		assert.ErrorIs(t, err, storage.ErrObjectLocked)
+		var lockedErr *storage.LockedError
+		require.True(t, errors.As(err, &lockedErr))
+		assert.False(t, lockedErr.RetainUntil.IsZero())
+
+		time.Sleep(60 * time.Millisecond)
+		require.NoError(t, fs.Delete(ctx, "foo"))
+		testutils.OpenNotExists(t, fs, "foo")
+
+		// Legal hold blocks deletion regardless of the retention
+		require.NoError(t, storage.Write(ctx, fs, "held", []byte("bar"), &storage.WriterOptions{
+			Attributes: storage.Attributes{
+				Metadata: map[string]string{
+					storage.WORMRetainUntilKey: time.Now().Add(-time.Hour).Format(time.RFC3339),
+					storage.WORMLegalHoldKey:   "true",
+				},
+			},
+		}))
+		err = fs.Delete(ctx, "held")
+		require.True(t, errors.As(err, &lockedErr))
+		assert.True(t, lockedErr.LegalHold)
+	})
+}
+
+func TestSetLegalHold(t *testing.T) {
+	ctx := context.Background()
+
+	check := func(base storage.FS) {
+		fs := storage.NewWORMWrapper(base, nil)
+		require.NoError(t, storage.Write(ctx, fs, "foo", []byte("bar"), &storage.WriterOptions{
+			Attributes: storage.Attributes{Metadata: map[string]string{"key": "value"}},
+		}))
+
+		require.NoError(t, storage.SetLegalHold(ctx, base, "foo", true))
+		var lockedErr *storage.LockedError
+		require.True(t, errors.As(fs.Delete(ctx, "foo"), &lockedErr))
+		assert.True(t, lockedErr.LegalHold)
+
+		// The content and other metadata are kept
+		testutils.OpenExists(t, fs, "foo", "bar")
+		attrs, err := fs.Attributes(ctx, "foo", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "value", attrs.Metadata["key"])
+
+		require.NoError(t, storage.SetLegalHold(ctx, base, "foo", false))
+		require.NoError(t, fs.Delete(ctx, "foo"))
+
+		paths, err := storage.List(ctx, base, "")
+		require.NoError(t, err)
+		assert.Empty(t, paths)
+
+		assert.True(t, storage.IsNotExist(storage.SetLegalHold(ctx, base, "foo", true)))
+	}
+
+	withMem(check)
+	// The metadata is updated by copying the file
+	withMem(func(mem storage.FS) {
+		check(storage.NewPrefixWrapper(mem, "prefix/"))
+	})
+}
+
+func TestWORMWrapper_URL(t *testing.T) {
+	ctx := context.Background()
+
+	withMem(func(mem storage.FS) {
+		fs := storage.NewWORMWrapper(mem, nil)
+
+		for _, method := range []string{"PUT", "put", "Delete", "POST"} {
+			_, err := fs.URL(ctx, "foo", &storage.SignedURLOptions{Method: method})
+			assert.ErrorIs(t, err, storage.ErrObjectLocked, method)
+		}
+
+		// memoryFS doesn't support URLs, but the method is allowed
+		_, err := fs.URL(ctx, "foo", &storage.SignedURLOptions{Method: "get"})
+		assert.ErrorIs(t, err, storage.ErrNotImplemented)
+	})
+}
+
+func TestWORMWrapper_failClosed(t *testing.T) {
+	ctx := context.Background()
+
+	withLocal(func(local storage.FS) {
+		// localFS doesn't persist the retention
+		fs := storage.NewWORMWrapper(local, &storage.WORMOptions{Retention: time.Hour})
+		err := storage.Write(ctx, fs, "foo", []byte("bar"), nil)
+		assert.ErrorIs(t, err, storage.ErrNotImplemented)
+		assert.ErrorIs(t, fs.Delete(ctx, "foo"), storage.ErrObjectLocked)
+		testutils.OpenExists(t, fs, "foo", "bar")
+
+		assert.ErrorIs(t, storage.SetLegalHold(ctx, local, "foo", true), storage.ErrNotImplemented)
+
+		// Directories are not deleted with their files
+		require.NoError(t, storage.Write(ctx, local, "dir/foo", []byte("bar"), nil))
+		assert.ErrorIs(t, fs.Delete(ctx, "dir"), storage.ErrObjectLocked)
+		testutils.OpenExists(t, fs, "dir/foo", "bar")
+	})
+
+	withMem(func(mem storage.FS) {
+		fs := storage.NewWORMWrapper(mem, &storage.WORMOptions{Retention: time.Hour})
+		require.NoError(t, storage.Write(ctx, mem, "foo", []byte("bar"), nil))
+		assert.ErrorIs(t, fs.Delete(ctx, "foo"), storage.ErrObjectLocked, "no retention information")
+	})
+}